@@ -29,6 +29,12 @@ func (run *Run) AddLatency(runClientsPath string, numMsgsToCalc int64) error {
 
 		if strings.HasSuffix(filepath.Base(path), "send_unixnano.evaluation") {
 
+			// Skip clients whose machine or whose
+			// partner's machine failed in this run.
+			if run.Excluded[strings.TrimSuffix(filepath.Base(path), "_send_unixnano.evaluation")] {
+				return nil
+			}
+
 			partner := ""
 
 			// Ingest supplied send times file.
@@ -249,6 +255,8 @@ func (run *Run) AddLatency(runClientsPath string, numMsgsToCalc int64) error {
 
 			// Append to list of client latencies.
 			run.Latencies = append(run.Latencies, msgLatencies)
+			run.LatencyPairings = append(run.LatencyPairings,
+				run.PairingOf(strings.TrimSuffix(filepath.Base(path), "_send_unixnano.evaluation")))
 		}
 
 		return nil
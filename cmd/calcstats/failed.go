@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FailedClients is the operator's record of
+// client machines that failed in a run and
+// which logical clients to leave out because
+// of that.
+type FailedClients struct {
+	ExcludedClients []string `json:"excludedClients"`
+}
+
+// LoadFailedClients reads in the 'failed-clients.json'
+// file the operator placed into the folder of a run
+// with tolerated client failures. Runs without this
+// file exclude no client.
+func (run *Run) LoadFailedClients(runPath string) error {
+
+	run.Excluded = make(map[string]bool)
+
+	content, err := ioutil.ReadFile(filepath.Join(runPath, "failed-clients.json"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	failed := &FailedClients{}
+
+	err = json.Unmarshal(content, failed)
+	if err != nil {
+		return fmt.Errorf("path: '%s', err: %v", runPath, err)
+	}
+
+	for i := range failed.ExcludedClients {
+		run.Excluded[failed.ExcludedClients[i]] = true
+	}
+
+	return nil
+}
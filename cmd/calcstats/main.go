@@ -32,6 +32,9 @@ type Run struct {
 	TimestampHighest           int64
 	NegativeLatenciesCnt       int64
 	Latencies                  [][]*MetricLatency
+	LatencyPairings            []string
+	Pairings                   map[string]string
+	Excluded                   map[string]bool
 	ClientsSentMiBytesHighest  []float64
 	ClientsRecvdMiBytesHighest []float64
 	ClientsCPULoad             []float64
@@ -79,6 +82,7 @@ func (set *Setting) AppendRun(runPath string, numServers float64, numClients flo
 		TimestampHighest:           0,
 		NegativeLatenciesCnt:       0,
 		Latencies:                  make([][]*MetricLatency, 0, 3000),
+		LatencyPairings:            make([]string, 0, 3000),
 		ClientsSentMiBytesHighest:  make([]float64, 0, 3000),
 		ClientsRecvdMiBytesHighest: make([]float64, 0, 3000),
 		ClientsCPULoad:             make([]float64, 0, 75000),
@@ -92,18 +96,34 @@ func (set *Setting) AppendRun(runPath string, numServers float64, numClients flo
 	clientsPath := filepath.Join(runPath, "clients")
 	serversPath := filepath.Join(runPath, "servers")
 
+	// Read in which kind of pair each client
+	// formed with its conversation partner.
+	err := run.LoadPairings(runPath)
+	if err != nil {
+		fmt.Printf("Ingesting pairing of clients failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Read in which logical clients to leave out
+	// due to tolerated failures of their machines.
+	err = run.LoadFailedClients(runPath)
+	if err != nil {
+		fmt.Printf("Ingesting failed clients failed: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Determine lowest and highest relevant
 	// timestamp of run while ingesting message
 	// latency metrics.
-	err := run.AddLatency(clientsPath, numMsgsToCalc)
+	err = run.AddLatency(clientsPath, numMsgsToCalc)
 	if err != nil {
 		fmt.Printf("Ingesting clients message latency metrics failed: %v\n", err)
 		os.Exit(1)
 	}
 
-	if len(run.Latencies) != int(run.NumClients) {
+	if len(run.Latencies) != (int(run.NumClients) - len(run.Excluded)) {
 		fmt.Printf("Run '%s' produced possibly wrong number of latency measurements (want: %d, saw: %d)\n",
-			runPath, int(run.NumClients), len(run.Latencies))
+			runPath, (int(run.NumClients) - len(run.Excluded)), len(run.Latencies))
 	}
 
 	// Read in highest value for number of outgoing
@@ -197,6 +217,13 @@ func (set *Setting) MetricsToFiles(settingsPath string) error {
 		return err
 	}
 
+	// Write message latencies broken down
+	// by the type of pair of clients.
+	err = set.LatenciesByPairingToFiles(settingsPath)
+	if err != nil {
+		return err
+	}
+
 	// Write total experiment times for clients.
 	err = set.TotalExpTimesToFile(settingsPath)
 	if err != nil {
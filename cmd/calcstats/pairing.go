@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Pair is the operator's record of the
+// conversation partner of one client.
+type Pair struct {
+	Client  string `json:"client"`
+	Partner string `json:"partner"`
+	Type    string `json:"type"`
+}
+
+// LoadPairings reads in the 'pairing.json' file the
+// operator placed into the folder of a run. Runs
+// predating this file count as 'unknown' pairs.
+func (run *Run) LoadPairings(runPath string) error {
+
+	run.Pairings = make(map[string]string)
+
+	content, err := ioutil.ReadFile(filepath.Join(runPath, "pairing.json"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	pairs := make([]*Pair, 0, 3000)
+
+	err = json.Unmarshal(content, &pairs)
+	if err != nil {
+		return fmt.Errorf("path: '%s', err: %v", runPath, err)
+	}
+
+	for i := range pairs {
+		run.Pairings[pairs[i].Client] = pairs[i].Type
+	}
+
+	return nil
+}
+
+// PairingOf returns the type of pair the
+// named client formed with its partner.
+func (run *Run) PairingOf(client string) string {
+
+	pairing, found := run.Pairings[client]
+	if !found {
+		return "unknown"
+	}
+
+	return pairing
+}
+
+// LatenciesByPairingToFiles writes out all
+// client-measured end-to-end transmission latencies
+// in seconds across all runs of this setting into
+// one file per type of pair, e.g., 'cross-zone'.
+func (set *Setting) LatenciesByPairingToFiles(path string) error {
+
+	latencies := make(map[string][]string)
+
+	for i := range set.Runs {
+
+		for j := range set.Runs[i].Latencies {
+
+			pairing := set.Runs[i].LatencyPairings[j]
+
+			for k := range set.Runs[i].Latencies[j] {
+				latencies[pairing] = append(latencies[pairing], fmt.Sprintf("%.5f", set.Runs[i].Latencies[j][k].Latency))
+			}
+		}
+	}
+
+	pairings := make([]string, 0, len(latencies))
+	for pairing := range latencies {
+		pairings = append(pairings, pairing)
+	}
+	sort.Strings(pairings)
+
+	for _, pairing := range pairings {
+
+		pairingFile, err := os.OpenFile(
+			filepath.Join(path, fmt.Sprintf("transmission-latencies_seconds_%s-pairs.data", pairing)),
+			(os.O_WRONLY | os.O_CREATE | os.O_TRUNC), 0644)
+		if err != nil {
+			return err
+		}
+
+		for i, latency := range latencies[pairing] {
+
+			if i > 0 {
+				fmt.Fprintf(pairingFile, ",")
+			}
+			fmt.Fprintf(pairingFile, "%s", latency)
+		}
+		fmt.Fprintf(pairingFile, "\n")
+
+		err = pairingFile.Sync()
+		if err != nil {
+			pairingFile.Close()
+			return err
+		}
+		pairingFile.Close()
+	}
+
+	return nil
+}
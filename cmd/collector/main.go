@@ -24,6 +24,14 @@ type Collector struct {
 	MetricsPath  string
 }
 
+// Client names one logical client on this
+// machine and the named pipe it sends its
+// metrics to.
+type Client struct {
+	Name string
+	Pipe string
+}
+
 func init() {
 
 	// Enable TLS 1.3.
@@ -70,7 +78,7 @@ func (col *Collector) collectSystemMetrics() {
 
 	// Prepare regular expression matching sent
 	// and received bytes values.
-	bytesRegexp := regexp.MustCompile(`(spt|dpt)\:(33|44)0((0\d)|10)`)
+	bytesRegexp := regexp.MustCompile(`(spt|dpt)\:(33|44)0\d\d\b`)
 
 	// Receive tick every second.
 	secTicker := time.NewTicker(time.Second)
@@ -383,32 +391,35 @@ func (col *Collector) writePoolSizesMetrics(metricsChan chan string, poolSizesFi
 	}
 }
 
+// parseClients extracts all clients from the
+// comma-separated 'name=pipe' pairs in value.
+func parseClients(value string) ([]*Client, error) {
+
+	clients := make([]*Client, 0, 10)
+
+	for _, pair := range strings.Split(value, ",") {
+
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("expected 'name=pipe' but found '%s'", pair)
+		}
+
+		clients = append(clients, &Client{
+			Name: parts[0],
+			Pipe: parts[1],
+		})
+	}
+
+	return clients, nil
+}
+
 func main() {
 
 	// Allow some command-line arguments.
 	systemFlag := flag.String("system", "", "Specify system that is being evaluated ('zeno', 'vuvuzela', or 'pung').")
 	typeOfNodeFlag := flag.String("typeOfNode", "", "Specify the type of node being evaluated ('client', 'server', 'coordinator').")
 	metricsPathFlag := flag.String("metricsPath", "./", "Specify the file system folder where the various metric files generated here should be placed.")
-	client01Flag := flag.String("client01", "client-00001", "Specify the name of client 01.")
-	pipe01Flag := flag.String("pipe01", "/tmp/collect01", "Specify named pipe 01 to use for metrics IPC.")
-	client02Flag := flag.String("client02", "client-00002", "Specify the name of client 02.")
-	pipe02Flag := flag.String("pipe02", "/tmp/collect02", "Specify named pipe 02 to use for metrics IPC.")
-	client03Flag := flag.String("client03", "client-00003", "Specify the name of client 03.")
-	pipe03Flag := flag.String("pipe03", "/tmp/collect03", "Specify named pipe 03 to use for metrics IPC.")
-	client04Flag := flag.String("client04", "client-00004", "Specify the name of client 04.")
-	pipe04Flag := flag.String("pipe04", "/tmp/collect04", "Specify named pipe 04 to use for metrics IPC.")
-	client05Flag := flag.String("client05", "client-00005", "Specify the name of client 05.")
-	pipe05Flag := flag.String("pipe05", "/tmp/collect05", "Specify named pipe 05 to use for metrics IPC.")
-	client06Flag := flag.String("client06", "client-00006", "Specify the name of client 06.")
-	pipe06Flag := flag.String("pipe06", "/tmp/collect06", "Specify named pipe 06 to use for metrics IPC.")
-	client07Flag := flag.String("client07", "client-00007", "Specify the name of client 07.")
-	pipe07Flag := flag.String("pipe07", "/tmp/collect07", "Specify named pipe 07 to use for metrics IPC.")
-	client08Flag := flag.String("client08", "client-00008", "Specify the name of client 08.")
-	pipe08Flag := flag.String("pipe08", "/tmp/collect08", "Specify named pipe 08 to use for metrics IPC.")
-	client09Flag := flag.String("client09", "client-00009", "Specify the name of client 09.")
-	pipe09Flag := flag.String("pipe09", "/tmp/collect09", "Specify named pipe 09 to use for metrics IPC.")
-	client10Flag := flag.String("client10", "client-00010", "Specify the name of client 10.")
-	pipe10Flag := flag.String("pipe10", "/tmp/collect10", "Specify named pipe 10 to use for metrics IPC.")
+	clientsFlag := flag.String("clients", "client-00001=/tmp/collect01", "Specify comma-separated pairs of client name and named pipe to use for metrics IPC, each as 'name=pipe'.")
 	flag.Parse()
 
 	if *systemFlag != "zeno" && *systemFlag != "vuvuzela" && *systemFlag != "pung" {
@@ -421,6 +432,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	clients, err := parseClients(*clientsFlag)
+	if err != nil {
+		fmt.Printf("Flag '-clients' malformed: %v\n", err)
+		os.Exit(1)
+	}
+
 	metricsPath, err := filepath.Abs(*metricsPathFlag)
 	if err != nil {
 		fmt.Printf("Error converting metrics path '%s' into absolute path: %v\n", *metricsPathFlag, err)
@@ -443,20 +460,13 @@ func main() {
 
 	if col.TypeOfNode == "client" {
 
-		wg.Add(10)
+		wg.Add(len(clients))
 
 		// Spawn background processes writing timing
 		// values into metrics files.
-		go col.collectTimingMetrics(wg, *pipe01Flag, *client01Flag)
-		go col.collectTimingMetrics(wg, *pipe02Flag, *client02Flag)
-		go col.collectTimingMetrics(wg, *pipe03Flag, *client03Flag)
-		go col.collectTimingMetrics(wg, *pipe04Flag, *client04Flag)
-		go col.collectTimingMetrics(wg, *pipe05Flag, *client05Flag)
-		go col.collectTimingMetrics(wg, *pipe06Flag, *client06Flag)
-		go col.collectTimingMetrics(wg, *pipe07Flag, *client07Flag)
-		go col.collectTimingMetrics(wg, *pipe08Flag, *client08Flag)
-		go col.collectTimingMetrics(wg, *pipe09Flag, *client09Flag)
-		go col.collectTimingMetrics(wg, *pipe10Flag, *client10Flag)
+		for i := range clients {
+			go col.collectTimingMetrics(wg, clients[i].Pipe, clients[i].Name)
+		}
 
 	} else {
 
@@ -464,7 +474,7 @@ func main() {
 
 		// Spawn background process writing message
 		// pool sizes to into metrics file.
-		go col.collectPoolSizesMetrics(wg, *pipe01Flag, *client01Flag)
+		go col.collectPoolSizesMetrics(wg, clients[0].Pipe, clients[0].Name)
 	}
 
 	// Wait for all metric collections
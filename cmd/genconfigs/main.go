@@ -17,6 +17,7 @@ type Exp struct {
 	System                       string          `json:"system"`
 	ServerZoneNetTroublesIfUsed  string          `json:"serverZoneNetTroublesIfUsed"`
 	ClientZonesNetTroublesIfUsed map[string]bool `json:"clientZonesNetTroublesIfUsed"`
+	ClientsPerMachine            int             `json:"clientsPerMachine"`
 	Servers                      []Worker        `json:"servers"`
 	Clients                      []Worker        `json:"clients"`
 }
@@ -150,12 +151,14 @@ func main() {
 
 	// Allow for control via command-line flags.
 	configsPathFlag := flag.String("configsPath", "./gcloud-configs/", "Specify file system location where GCloud Compute configurations are supposed to be saved.")
-	numClientsToGenFlag := flag.Int("numClientsToGen", 1000, "Specify the number of client nodes to generate. Number of conversing clients will be ten times as much.")
+	numClientsToGenFlag := flag.Int("numClientsToGen", 1000, "Specify the number of client nodes to generate. Number of conversing clients will be this times the clients per machine.")
+	clientsPerMachineFlag := flag.Int("clientsPerMachine", 10, "Specify the number of conversing clients to run on each client node.")
 	numVuvuzelaMixesToGenFlag := flag.Int("numVuvuzelaMixesToGen", 7, "Specify the number of vuvuzela mix nodes to generate (number of zeno mixes is twice this number minus 1).")
 	numZenoCascadesFlag := flag.Int("numZenoCascades", 1, "Specify the number of cascades in zeno to generate.")
 	flag.Parse()
 
 	numClientsToGen := *numClientsToGenFlag
+	clientsPerMachine := *clientsPerMachineFlag
 	numVuvuzelaMixesToGen := *numVuvuzelaMixesToGenFlag
 	numZenoCascades := *numZenoCascadesFlag
 
@@ -206,6 +209,7 @@ func main() {
 		System:                       "zeno",
 		ServerZoneNetTroublesIfUsed:  GCloudZones[0],
 		ClientZonesNetTroublesIfUsed: netTroubleZones,
+		ClientsPerMachine:            clientsPerMachine,
 		Servers:                      make([]Worker, (numZenoCascades * ((2 * numVuvuzelaMixesToGen) - 1))),
 		Clients:                      make([]Worker, numClientsToGen),
 	}
@@ -214,6 +218,7 @@ func main() {
 		System:                       "vuvuzela",
 		ServerZoneNetTroublesIfUsed:  GCloudZones[0],
 		ClientZonesNetTroublesIfUsed: netTroubleZones,
+		ClientsPerMachine:            clientsPerMachine,
 		Servers:                      make([]Worker, numVuvuzelaMixesToGen),
 		Clients:                      make([]Worker, numClientsToGen),
 	}
@@ -222,6 +227,7 @@ func main() {
 		System:                       "pung",
 		ServerZoneNetTroublesIfUsed:  GCloudZones[0],
 		ClientZonesNetTroublesIfUsed: netTroubleZones,
+		ClientsPerMachine:            clientsPerMachine,
 		Servers:                      make([]Worker, 1),
 		Clients:                      make([]Worker, numClientsToGen),
 	}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+// APIToken grants its holder access to all
+// routes of the public API covered by one
+// of its scopes: 'submit', 'view', or 'terminate'.
+type APIToken struct {
+	Name   string   `json:"name"`
+	Token  string   `json:"token"`
+	Scopes []string `json:"scopes"`
+}
+
+// AuditRecord is one line in the audit log of
+// actions taken via the public API.
+type AuditRecord struct {
+	Time       string `json:"time"`
+	Principal  string `json:"principal"`
+	Action     string `json:"action"`
+	ExpID      string `json:"expID,omitempty"`
+	RemoteAddr string `json:"remoteAddr"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// maxDeniedHosts bounds the number of remote hosts
+// whose unauthenticated requests are counted
+// separately between two flushes.
+const maxDeniedHosts = 1024
+
+// AuditLog appends records of who submitted or
+// terminated which experiment, and of rejected
+// requests, to a JSON log on disk.
+type AuditLog struct {
+	sync.Mutex
+	File *os.File
+	Enc  *json.Encoder
+
+	// Requests without a valid bearer token
+	// per remote host since the last flush.
+	Denied map[string]int
+}
+
+// LoadAPITokens reads the list of tokens accepted
+// by the public API from a JSON file.
+func LoadAPITokens(path string) ([]*APIToken, error) {
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]*APIToken, 0, 5)
+	err = json.Unmarshal(content, &tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tokens {
+
+		if tokens[i].Name == "" || len(tokens[i].Token) < 16 {
+			return nil, fmt.Errorf("token %d requires a name and a token of at least 16 characters", (i + 1))
+		}
+
+		for j := range tokens[i].Scopes {
+
+			if tokens[i].Scopes[j] != "submit" && tokens[i].Scopes[j] != "view" && tokens[i].Scopes[j] != "terminate" {
+				return nil, fmt.Errorf("token '%s' has unknown scope '%s'", tokens[i].Name, tokens[i].Scopes[j])
+			}
+		}
+	}
+
+	return tokens, nil
+}
+
+// hasScope reports whether the token
+// grants access to the supplied scope.
+func (token *APIToken) hasScope(scope string) bool {
+
+	for i := range token.Scopes {
+
+		if token.Scopes[i] == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// OpenAuditLog opens the audit log at
+// path for appending records.
+func OpenAuditLog(path string) (*AuditLog, error) {
+
+	file, err := os.OpenFile(path, (os.O_WRONLY | os.O_CREATE | os.O_APPEND), 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuditLog{
+		File:   file,
+		Enc:    json.NewEncoder(file),
+		Denied: make(map[string]int),
+	}, nil
+}
+
+// Record appends one action to the audit log
+// and syncs it to stable storage.
+func (audit *AuditLog) Record(principal string, action string, expID string, remoteAddr string, detail string) {
+
+	audit.Lock()
+	defer audit.Unlock()
+
+	err := audit.Enc.Encode(&AuditRecord{
+		Time:       time.Now().UTC().Format(time.RFC3339),
+		Principal:  principal,
+		Action:     action,
+		ExpID:      expID,
+		RemoteAddr: remoteAddr,
+		Detail:     detail,
+	})
+	if err == nil {
+		err = audit.File.Sync()
+	}
+
+	if err != nil {
+		fmt.Printf("[AUDIT] Failed recording '%s' by '%s': %v\n", action, principal, err)
+	}
+}
+
+// RecordUnauthenticated counts a request without a
+// valid bearer token from remoteAddr. Instead of one
+// synced record per request, which anyone able to
+// reach the public API could cause at will, these
+// are written as one record per remote host by
+// FlushDenied.
+func (audit *AuditLog) RecordUnauthenticated(remoteAddr string) {
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	audit.Lock()
+	defer audit.Unlock()
+
+	// Count hosts beyond the bound together so
+	// that spoofed sources cannot grow the map.
+	if _, found := audit.Denied[host]; !found && len(audit.Denied) >= maxDeniedHosts {
+		host = "other"
+	}
+
+	audit.Denied[host]++
+}
+
+// FlushDenied writes one record per remote host
+// counted by RecordUnauthenticated since the last
+// flush and syncs them to stable storage at once.
+func (audit *AuditLog) FlushDenied(since time.Duration) {
+
+	audit.Lock()
+	defer audit.Unlock()
+
+	if len(audit.Denied) == 0 {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	var err error
+	for host, count := range audit.Denied {
+
+		if err == nil {
+			err = audit.Enc.Encode(&AuditRecord{
+				Time:       now,
+				Action:     "denied",
+				RemoteAddr: host,
+				Detail:     fmt.Sprintf("%d requests without valid bearer token in the last %s", count, since),
+			})
+		}
+	}
+	if err == nil {
+		err = audit.File.Sync()
+	}
+
+	if err != nil {
+		fmt.Printf("[AUDIT] Failed recording unauthenticated requests of %d hosts: %v\n", len(audit.Denied), err)
+	}
+
+	audit.Denied = make(map[string]int)
+}
+
+// RunDeniedFlusher writes the counted unauthenticated
+// requests to the audit log every interval.
+func (audit *AuditLog) RunDeniedFlusher(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		audit.FlushDenied(interval)
+	}
+}
+
+// lookupToken returns the API token matching the
+// supplied secret, or nil. All tokens are compared
+// in constant time.
+func (op *Operator) lookupToken(secret string) *APIToken {
+
+	var match *APIToken
+
+	for i := range op.APITokens {
+
+		if subtle.ConstantTimeCompare([]byte(op.APITokens[i].Token), []byte(secret)) == 1 {
+			match = op.APITokens[i]
+		}
+	}
+
+	return match
+}
+
+// PublicAuth returns a filter requiring a bearer
+// token with the supplied scope in the Authorization
+// header of each request for continuation. The name
+// of the token is attached to the request as its
+// principal.
+func (op *Operator) PublicAuth(scope string) restful.FilterFunction {
+
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+
+		authHeader := req.HeaderParameter("Authorization")
+		expID := req.PathParameter("expID")
+
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			op.Audit.RecordUnauthenticated(req.Request.RemoteAddr)
+			resp.WriteError(http.StatusUnauthorized, nil)
+			return
+		}
+
+		token := op.lookupToken(strings.TrimPrefix(authHeader, "Bearer "))
+		if token == nil {
+			op.Audit.RecordUnauthenticated(req.Request.RemoteAddr)
+			resp.WriteError(http.StatusUnauthorized, nil)
+			return
+		}
+
+		if !token.hasScope(scope) {
+			op.Audit.Record(token.Name, "denied", expID, req.Request.RemoteAddr, fmt.Sprintf("missing scope '%s' for %s", scope, req.Request.URL.Path))
+			resp.WriteError(http.StatusForbidden, nil)
+			return
+		}
+
+		req.SetAttribute("principal", token.Name)
+
+		// Possibly move to next filter.
+		chain.ProcessFilter(req, resp)
+	}
+}
+
+// principal returns the name of the token
+// that authenticated the request.
+func principal(req *restful.Request) string {
+
+	name, ok := req.Attribute("principal").(string)
+	if !ok {
+		return ""
+	}
+
+	return name
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/emicklei/go-restful"
 )
@@ -12,17 +18,173 @@ import (
 // of the first logical node on a worker instance
 // to the operator.
 type RegisterReq struct {
-	Worker  string `json:"-"`
 	Address string `json:"address"`
 }
 
 // FailedReq captures all information taken
 // from a failure signal from a worker.
 type FailedReq struct {
-	Worker string `json:"-"`
 	Reason string `json:"failure"`
 }
 
+// WorkerEvent is one callback of a worker handed
+// to the runner conducting its experiment.
+type WorkerEvent struct {
+	Worker  string
+	State   WorkerState
+	Address string
+	Reason  string
+}
+
+// NewWorkerToken generates a random secret
+// that identifies one worker of an experiment.
+func NewWorkerToken() (string, error) {
+
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", token), nil
+}
+
+// InternalLookup augments all internal routes by
+// safely looking up the experiment and worker named
+// in the path. Unknown ones are answered with 404,
+// experiments not being conducted anymore with 410.
+func (op *Operator) InternalLookup(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+
+	expID := req.PathParameter("expID")
+	workerName := req.PathParameter("worker")
+
+	op.Lock()
+
+	var worker *Worker
+	exp, found := op.Exps[expID]
+	if found {
+		worker, found = exp.worker(workerName)
+	}
+
+	state := ExpState("")
+	if found {
+		state = exp.State
+	}
+
+	op.Unlock()
+
+	if !found {
+		drain(req)
+		fmt.Printf("[INTERNAL] Rejected call from %s for unknown worker %s of experiment %s.\n", req.Request.RemoteAddr, workerName, expID)
+		resp.WriteErrorString(http.StatusNotFound, fmt.Sprintf("Worker %s of experiment %s does not exist.", workerName, expID))
+		return
+	}
+
+	// Only experiments still being provisioned
+	// or running listen to their workers.
+	if state != ExpProvisioning && state != ExpRunning {
+		drain(req)
+		fmt.Printf("[INTERNAL] Rejected call from %s for worker %s of experiment %s in state '%s'.\n", req.Request.RemoteAddr, workerName, expID, state)
+		resp.WriteErrorString(http.StatusGone, fmt.Sprintf("Experiment %s is %s.", expID, state))
+		return
+	}
+
+	req.SetAttribute("exp", exp)
+	req.SetAttribute("worker", worker)
+
+	// Possibly move to next filter.
+	chain.ProcessFilter(req, resp)
+}
+
+// InternalAuth augments all internal routes by
+// requiring the bearer token minted for the worker
+// named in the path in order for continuation.
+func (op *Operator) InternalAuth(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+
+	worker := req.Attribute("worker").(*Worker)
+
+	authHeader := req.HeaderParameter("Authorization")
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+
+	// The token changes whenever the
+	// worker's instance is replaced.
+	op.Lock()
+	expected := worker.Token
+	op.Unlock()
+
+	if expected == "" || !strings.HasPrefix(authHeader, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(expected), []byte(token)) != 1 {
+		drain(req)
+		fmt.Printf("[INTERNAL] Rejected call from %s with invalid token for worker %s of experiment %s.\n",
+			req.Request.RemoteAddr, worker.Name, req.PathParameter("expID"))
+		resp.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Possibly move to next filter.
+	chain.ProcessFilter(req, resp)
+}
+
+// drain reads the remaining body of a request
+// before it is answered, so that the worker does
+// not see its stream reset.
+func drain(req *restful.Request) {
+
+	_, _ = io.Copy(ioutil.Discard, req.Request.Body)
+}
+
+// deliver hands a worker event to the runner without
+// blocking. If the experiment's event buffer is full,
+// the worker is asked to retry later.
+func (op *Operator) deliver(req *restful.Request, resp *restful.Response, event *WorkerEvent) {
+
+	exp := req.Attribute("exp").(*Exp)
+	worker := req.Attribute("worker").(*Worker)
+
+	drain(req)
+
+	op.Lock()
+	defer op.Unlock()
+
+	select {
+
+	case exp.Events <- event:
+		worker.Reported = event.State
+		resp.WriteHeader(http.StatusOK)
+
+	default:
+		fmt.Printf("[INTERNAL] Event buffer of experiment %s full, asking %s to retry.\n", exp.ID, event.Worker)
+		resp.WriteErrorString(http.StatusServiceUnavailable, "Too many pending worker events, retry later.")
+	}
+}
+
+// rejectIllegal answers a callback with a conflict
+// if the worker cannot move to the state signalled
+// by it, e.g., because it already finished.
+func (op *Operator) rejectIllegal(req *restful.Request, resp *restful.Response, state WorkerState) bool {
+
+	worker := req.Attribute("worker").(*Worker)
+
+	// Events of a worker might not have been applied
+	// by the runner yet, check against the one reported
+	// last unless the runner already ended the worker.
+	op.Lock()
+	from := worker.Reported
+	if worker.ended() {
+		from = worker.Status
+	}
+	op.Unlock()
+
+	if !from.CanEnter(state) {
+		drain(req)
+		fmt.Printf("[INTERNAL] Rejected callback of %s moving it from '%s' to '%s'.\n", worker.Name, from, state)
+		resp.WriteErrorString(http.StatusConflict, fmt.Sprintf("Worker %s cannot move from '%s' to '%s'.", worker.Name, from, state))
+		return true
+	}
+
+	return false
+}
+
 // HandlerPutRegister accepts a newly booted
 // machine as a new worker for the specified
 // experiment to be conducted.
@@ -31,6 +193,10 @@ func (op *Operator) HandlerPutRegister(req *restful.Request, resp *restful.Respo
 	expID := req.PathParameter("expID")
 	workerName := req.PathParameter("worker")
 
+	if op.rejectIllegal(req, resp, WorkerRegistered) {
+		return
+	}
+
 	// Read address information from request.
 	regReq := &RegisterReq{}
 	err := req.ReadEntity(&regReq)
@@ -40,12 +206,30 @@ func (op *Operator) HandlerPutRegister(req *restful.Request, resp *restful.Respo
 		return
 	}
 
-	regReq.Worker = workerName
+	// Registration counts as first heartbeat.
+	op.Lock()
+	req.Attribute("worker").(*Worker).LastHeartbeat = time.Now()
+	op.Unlock()
 
 	// Signal runner which worker intends to register.
-	op.Exps[expID].RegisterChan <- regReq
+	op.deliver(req, resp, &WorkerEvent{
+		Worker:  workerName,
+		State:   WorkerRegistered,
+		Address: regReq.Address,
+	})
+}
+
+// HandlerPutHeartbeat records that a worker
+// is still alive. Registered workers are expected
+// to call this endpoint periodically.
+func (op *Operator) HandlerPutHeartbeat(req *restful.Request, resp *restful.Response) {
+
+	drain(req)
+
+	op.Lock()
+	req.Attribute("worker").(*Worker).LastHeartbeat = time.Now()
+	op.Unlock()
 
-	// Respond to worker node.
 	resp.WriteHeader(http.StatusOK)
 }
 
@@ -55,14 +239,15 @@ func (op *Operator) HandlerPutRegister(req *restful.Request, resp *restful.Respo
 // steps before calling this endpoint.
 func (op *Operator) HandlerPutReady(req *restful.Request, resp *restful.Response) {
 
-	expID := req.PathParameter("expID")
-	workerName := req.PathParameter("worker")
+	if op.rejectIllegal(req, resp, WorkerReady) {
+		return
+	}
 
 	// Signal runner which worker is ready.
-	op.Exps[expID].ReadyChan <- workerName
-
-	// Respond to worker node.
-	resp.WriteHeader(http.StatusOK)
+	op.deliver(req, resp, &WorkerEvent{
+		Worker: req.PathParameter("worker"),
+		State:  WorkerReady,
+	})
 }
 
 // HandlerPutFinished signals the operator that
@@ -70,13 +255,15 @@ func (op *Operator) HandlerPutReady(req *restful.Request, resp *restful.Response
 // designated for it in the running experiment.
 func (op *Operator) HandlerPutFinished(req *restful.Request, resp *restful.Response) {
 
-	expID := req.PathParameter("expID")
-	workerName := req.PathParameter("worker")
+	if op.rejectIllegal(req, resp, WorkerFinished) {
+		return
+	}
 
 	// Signal runner which worker has finished.
-	op.Exps[expID].FinishedChan <- workerName
-
-	resp.WriteHeader(http.StatusOK)
+	op.deliver(req, resp, &WorkerEvent{
+		Worker: req.PathParameter("worker"),
+		State:  WorkerFinished,
+	})
 }
 
 // HandlerPutFailed sends a failure signal and
@@ -86,6 +273,10 @@ func (op *Operator) HandlerPutFailed(req *restful.Request, resp *restful.Respons
 	expID := req.PathParameter("expID")
 	workerName := req.PathParameter("worker")
 
+	if op.rejectIllegal(req, resp, WorkerFailed) {
+		return
+	}
+
 	// Read failure information from request.
 	failedReq := &FailedReq{}
 	err := req.ReadEntity(&failedReq)
@@ -95,12 +286,12 @@ func (op *Operator) HandlerPutFailed(req *restful.Request, resp *restful.Respons
 		return
 	}
 
-	failedReq.Worker = workerName
-
 	// Signal runner which worker has failed.
-	op.Exps[expID].FailedChan <- failedReq
-
-	resp.WriteHeader(http.StatusOK)
+	op.deliver(req, resp, &WorkerEvent{
+		Worker: workerName,
+		State:  WorkerFailed,
+		Reason: failedReq.Reason,
+	})
 }
 
 // PrepareInternalSrv initializes all API-related
@@ -115,15 +306,28 @@ func (op *Operator) PrepareInternalSrv() {
 		Produces(restful.MIME_JSON)
 
 	op.InternalSrv.Route(op.InternalSrv.PUT("/{expID}/workers/{worker}/register").
+		Filter(op.InternalLookup).
+		Filter(op.InternalAuth).
 		To(op.HandlerPutRegister))
 
+	op.InternalSrv.Route(op.InternalSrv.PUT("/{expID}/workers/{worker}/heartbeat").
+		Filter(op.InternalLookup).
+		Filter(op.InternalAuth).
+		To(op.HandlerPutHeartbeat))
+
 	op.InternalSrv.Route(op.InternalSrv.PUT("/{expID}/workers/{worker}/ready").
+		Filter(op.InternalLookup).
+		Filter(op.InternalAuth).
 		To(op.HandlerPutReady))
 
 	op.InternalSrv.Route(op.InternalSrv.PUT("/{expID}/workers/{worker}/finished").
+		Filter(op.InternalLookup).
+		Filter(op.InternalAuth).
 		To(op.HandlerPutFinished))
 
 	op.InternalSrv.Route(op.InternalSrv.PUT("/{expID}/workers/{worker}/failed").
+		Filter(op.InternalLookup).
+		Filter(op.InternalAuth).
 		To(op.HandlerPutFailed))
 
 	restful.Add(op.InternalSrv)
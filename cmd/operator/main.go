@@ -3,9 +3,12 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/emicklei/go-restful"
 	"github.com/numbleroot/acs-test-bed/cmd/operator/zenopki"
@@ -30,7 +33,44 @@ type Operator struct {
 	InternalSrv        *restful.WebService
 	PublicListenAddr   string
 	PublicSrv          *restful.WebService
-	PublicNewChan      chan string
+	Queue              *ExpQueue
+
+	Provider       Provider
+	LocalBucketDir string
+
+	RegisterTimeout  time.Duration
+	ReadyTimeout     time.Duration
+	FinishTimeout    time.Duration
+	HeartbeatTimeout time.Duration
+
+	CreateRetries    int
+	CreateBackoff    time.Duration
+	CreateBackoffMax time.Duration
+	ZoneFallback     bool
+
+	RespawnAttempts  int
+	RespawnOtherZone bool
+
+	PreemptionPollInterval time.Duration
+
+	InstanceTTL time.Duration
+
+	TeardownPolicy string
+
+	SpawnConcurrency int
+
+	Pricing          *Pricing
+	Budget           float64
+	ExpectedDuration time.Duration
+
+	Notifier *Notifier
+
+	ExpHooks    map[ExpState][]ExpHook
+	WorkerHooks map[WorkerState][]WorkerHook
+
+	Store     *Store
+	APITokens []*APIToken
+	Audit     *AuditLog
 
 	ExpInProgress string
 	Exps          map[string]*Exp
@@ -41,42 +81,95 @@ type Operator struct {
 // Exp contains all information relevant
 // for monitoring an experiment.
 type Exp struct {
-	ID           string             `json:"id"`
-	Created      string             `json:"created"`
-	System       string             `json:"system"`
-	Concluded    bool               `json:"concluded"`
-	ResultFolder string             `json:"resultFolder"`
-	Progress     []string           `json:"progress"`
-	ProgressChan chan string        `json:"-"`
-	Servers      []*Worker          `json:"servers"`
-	ServersMap   map[string]*Worker `json:"-"`
-	Clients      []*Worker          `json:"clients"`
-	ClientsMap   map[string]*Worker `json:"-"`
-
-	RegisterChan  chan *RegisterReq `json:"-"`
-	ReadyChan     chan string       `json:"-"`
-	FinishedChan  chan string       `json:"-"`
-	FailedChan    chan *FailedReq   `json:"-"`
+	ID                 string             `json:"id"`
+	Created            string             `json:"created"`
+	System             string             `json:"system"`
+	State              ExpState           `json:"state"`
+	Transitions        []*Transition      `json:"transitions"`
+	SubmittedBy        string             `json:"submittedBy"`
+	Priority           int                `json:"priority"`
+	Queued             bool               `json:"queued"`
+	QueuedAt           int64              `json:"queuedAt"`
+	QueuePosition      int                `json:"queuePosition"`
+	Concluded          bool               `json:"concluded"`
+	FailureReason      string             `json:"failureReason"`
+	Recovered          bool               `json:"recovered"`
+	ResultFolder       string             `json:"resultFolder"`
+	ClientsPerMachine  int                `json:"clientsPerMachine"`
+	Pairing            PairingStrategy    `json:"pairing"`
+	PairingSeed        int64              `json:"pairingSeed"`
+	Pairs              []*Pair            `json:"pairs"`
+	Cost               *CostEstimate      `json:"cost,omitempty"`
+	TeardownPolicy     string             `json:"teardownPolicy"`
+	ClientTolerance    string             `json:"clientTolerance"`
+	PreemptibleClients bool               `json:"preemptibleClients"`
+	TeardownTrigger    string             `json:"teardownTrigger,omitempty"`
+	PartnersMap        map[string]string  `json:"-"`
+	Progress           []string           `json:"progress"`
+	ProgressChan       chan string        `json:"-"`
+	ProgressLock       sync.Mutex         `json:"-"`
+	ProgressWake       chan struct{}      `json:"-"`
+	Servers            []*Worker          `json:"servers"`
+	ServersMap         map[string]*Worker `json:"-"`
+	Clients            []*Worker          `json:"clients"`
+	ClientsMap         map[string]*Worker `json:"-"`
+
+	Events        chan *WorkerEvent `json:"-"`
+	TimedOutChan  chan *Worker      `json:"-"`
+	PreemptedChan chan *Worker      `json:"-"`
 	TerminateChan chan struct{}     `json:"-"`
+	TerminateBy   string            `json:"-"`
+	ServersFixed  bool              `json:"-"`
+
+	SpawnsStopped chan struct{}  `json:"-"`
+	Spawns        sync.WaitGroup `json:"-"`
 }
 
 // Worker describes one compute instance
 // exhaustively for reproducibility.
 type Worker struct {
-	ID              int    `json:"id"`
-	Name            string `json:"name"`
-	Address         string `json:"address"`
-	Status          string `json:"status"`
-	Zone            string `json:"zone"`
-	MinCPUPlatform  string `json:"minCPUPlatform"`
-	MachineType     string `json:"machineType"`
-	TypeOfNode      string `json:"typeOfNode"`
-	BinaryName      string `json:"binaryName"`
-	SourceImage     string `json:"sourceImage"`
-	DiskType        string `json:"diskType"`
-	DiskSize        string `json:"diskSize"`
-	NetTroubles     string `json:"netTroubles"`
-	ZenoMixesKilled int    `json:"zenoMixesKilled"`
+	ID              int           `json:"id"`
+	Name            string        `json:"name"`
+	Address         string        `json:"address"`
+	Status          WorkerState   `json:"status"`
+	Reported        WorkerState   `json:"-"`
+	Transitions     []*Transition `json:"transitions"`
+	LastHeartbeat   time.Time     `json:"lastHeartbeat"`
+	Spawned         bool          `json:"spawned"`
+	Instance        string        `json:"instance,omitempty"`
+	Respawns        int           `json:"respawns"`
+	Preemptible     bool          `json:"preemptible"`
+	Token           string        `json:"-"`
+	Zone            string        `json:"zone"`
+	MinCPUPlatform  string        `json:"minCPUPlatform"`
+	MachineType     string        `json:"machineType"`
+	TypeOfNode      string        `json:"typeOfNode"`
+	BinaryName      string        `json:"binaryName"`
+	SourceImage     string        `json:"sourceImage"`
+	DiskType        string        `json:"diskType"`
+	DiskSize        string        `json:"diskSize"`
+	NetTroubles     string        `json:"netTroubles"`
+	ZenoMixesKilled int           `json:"zenoMixesKilled"`
+}
+
+// AccessToken returns the most recent GCloud
+// access token supplied via the public API.
+func (op *Operator) AccessToken() string {
+
+	op.Lock()
+	defer op.Unlock()
+
+	return op.GCloudAccessToken
+}
+
+// SetAccessToken replaces the GCloud access
+// token used for calls to the compute API.
+func (op *Operator) SetAccessToken(accessToken string) {
+
+	op.Lock()
+	defer op.Unlock()
+
+	op.GCloudAccessToken = accessToken
 }
 
 func init() {
@@ -99,10 +192,78 @@ func main() {
 	gcloudBucketFlag := flag.String("gcloudBucket", "", "Supply the GCloud Storage Bucket to use for the experiments.")
 	certPathFlag := flag.String("certPath", "/root/operator-cert.pem", "Supply file system location of the operator's TLS certificate.")
 	keyPathFlag := flag.String("keyPath", "/root/operator-key.pem", "Supply file system location of the operator's TLS key.")
+	gcloudAccessTokenFlag := flag.String("gcloudAccessToken", "", "Optionally supply a GCloud access token to use until one arrives via the public API (e.g., for tearing down recovered experiments).")
+	tokensPathFlag := flag.String("tokensPath", "/root/operator-tokens.json", "Specify file system location of the JSON list of bearer tokens and their scopes ('submit', 'view', 'terminate') accepted by the public API.")
+	auditLogPathFlag := flag.String("auditLogPath", "/root/operator-audit.log", "Specify file system location of the log recording who submitted or terminated which experiment.")
+	auditDeniedIntervalFlag := flag.Duration("auditDeniedInterval", time.Minute, "Specify how often to write the number of requests without a valid bearer token per remote host to the audit log, instead of one record per request.")
+	storePathFlag := flag.String("storePath", "/root/operator-exps.log", "Specify file system location of the log persisting all experiments across operator restarts.")
+	storeSyncIntervalFlag := flag.Duration("storeSyncInterval", (10 * time.Second), "Specify how often to sync progress lines of experiments to the experiment store on disk and to check its size against '-storeCompactSize'.")
+	storeCompactSizeFlag := flag.Int64("storeCompactSize", 64, "Specify in MiB beyond which size the log of the experiment store gets compacted to one snapshot per experiment.")
+	registerTimeoutFlag := flag.Duration("registerTimeout", (10 * time.Minute), "Specify how long to wait for all servers or clients to register after spawning them (0 waits forever).")
+	readyTimeoutFlag := flag.Duration("readyTimeout", (30 * time.Minute), "Specify how long to wait for all registered servers or clients to become ready (0 waits forever).")
+	finishTimeoutFlag := flag.Duration("finishTimeout", 0, "Specify how long to wait for all workers to finish once clients are ready (0 waits forever).")
+	heartbeatTimeoutFlag := flag.Duration("heartbeatTimeout", (3 * time.Minute), "Specify after how long without a heartbeat a registered worker is marked as timed out (0 disables heartbeat checks).")
+	createRetriesFlag := flag.Int("createRetries", 8, "Specify how often to retry creating or deleting an instance after a transient provider error.")
+	createBackoffFlag := flag.Duration("createBackoff", (2 * time.Second), "Specify the initial delay before retrying to create or delete an instance, doubled with every further attempt.")
+	createBackoffMaxFlag := flag.Duration("createBackoffMax", (2 * time.Minute), "Specify the maximum delay before retrying to create or delete an instance.")
+	zoneFallbackFlag := flag.Bool("zoneFallback", false, "Append this flag to create instances in another zone of the same region if their zone is out of quota or capacity.")
+	respawnAttemptsFlag := flag.Int("respawnAttempts", 0, "Specify how often to replace the instance of a registered worker that fails or stops sending heartbeats before it is ready (0 disables respawning).")
+	respawnOtherZoneFlag := flag.Bool("respawnOtherZone", false, "If '-respawnAttempts' is used, append this flag to create replacement instances in another zone of the same region.")
+	preemptionPollIntervalFlag := flag.Duration("preemptionPollInterval", (30 * time.Second), "Specify how often to check preemptible client instances of the running experiment for preemption (0 disables the check).")
+	reapIntervalFlag := flag.Duration("reapInterval", (15 * time.Minute), "Specify how often to delete instances whose experiment concluded or is unknown, and to terminate experiments with instances that outlived '-instanceTTL' (0 disables the reaper).")
+	instanceTTLFlag := flag.Duration("instanceTTL", (24 * time.Hour), "Specify after how long an instance makes the reaper fail and tear down the experiment it belongs to (0 disables the TTL).")
+	spawnConcurrencyFlag := flag.Int("spawnConcurrency", 16, "Specify how many instances to spawn in parallel at most.")
+	providerRateFlag := flag.Float64("providerRate", 10, "Specify how many calls per second to send to the compute provider at most (0 disables rate limiting).")
+	providerBurstFlag := flag.Int("providerBurst", 20, "Specify how many calls to the compute provider may be sent in a burst before '-providerRate' applies.")
+	pricingPathFlag := flag.String("pricingPath", "", "Optionally specify the file system location of the JSON pricing table to estimate the cost of submitted experiments with.")
+	budgetFlag := flag.Float64("budget", 0, "If '-pricingPath' is used, reject experiments whose estimated cost for their expected duration exceeds this amount (0 disables the budget).")
+	expectedDurationFlag := flag.Duration("expectedDuration", (1 * time.Hour), "If '-pricingPath' is used, specify the duration to estimate the cost for if an experiment does not state its own.")
+	teardownPolicyFlag := flag.String("teardownPolicy", "manual", "Specify how to shut down experiments that reached their end and do not set their own policy: 'manual' (await confirmation), 'on-finish', 'on-finish-after=DURATION', or 'on-failure-keep-for-debug=DURATION'.")
+	webhooksFlag := flag.String("webhooks", "", "Optionally specify a comma-separated list of URLs to POST experiment lifecycle events to.")
+	webhookSecretFlag := flag.String("webhookSecret", "", "If '-webhooks' is used, specify the secret to sign events with (HMAC-SHA256 in header 'X-ACS-Signature'), falls back to environment variable ACS_WEBHOOK_SECRET.")
+	metricsAddrFlag := flag.String("metricsAddr", "127.0.0.1:9464", "Specify the address to serve Prometheus metrics on via plain HTTP at '/metrics' (empty disables the endpoint).")
+	providerFlag := flag.String("provider", "gce", "Specify the compute provider to spawn instances on: 'gce', 'local' (processes on this machine), or 'mem' (in-memory only, nothing is booted).")
+	gceEndpointFlag := flag.String("gceEndpoint", "https://www.googleapis.com/compute/v1", "If '-provider gce' is used, specify the GCE API endpoint to send requests to (e.g., a fake GCE server).")
+	gceOperationTimeoutFlag := flag.Duration("gceOperationTimeout", (5 * time.Minute), "If '-provider gce' is used, specify how long to wait for a zone operation to complete.")
+	localScriptFlag := flag.String("localScript", "./scripts/startup.sh", "If '-provider local' is used, specify the startup script to run for each worker.")
+	localDirFlag := flag.String("localDir", "/tmp/acs-eval-local/", "If '-provider local' is used, specify the folder to place worker folders and the stand-in storage bucket in.")
+	localSkelDirFlag := flag.String("localSkelDir", "", "If '-provider local' is used, optionally specify a folder whose contents are copied into each worker folder (e.g., 'vuvuzela-confs').")
+	localMetadataPortFlag := flag.Int("localMetadataPort", 20080, "If '-provider local' is used, specify the port to serve instance metadata on.")
+	localNetNSFlag := flag.Bool("localNetNS", false, "If '-provider local' is used, append this flag to run each worker in its own network namespace (requires root and '-internalAddr' to listen on all interfaces, e.g., '0.0.0.0:443').")
+	memMetadataDirFlag := flag.String("memMetadataDir", "", "If '-provider mem' is used, optionally specify a folder to write the metadata of each instance to, e.g., its worker token to drive the internal API by hand.")
+	memPreemptAfterFlag := flag.Duration("memPreemptAfter", 0, "If '-provider mem' is used, optionally specify after how long preemptible instances get preempted (0 never preempts them).")
+	memExhaustedZonesFlag := flag.String("memExhaustedZones", "", "If '-provider mem' is used, optionally specify a comma-separated list of zones in which creating instances fails with a quota error.")
 
 	flag.Parse()
 
-	if *gcloudServiceAccFlag == "" || *gcloudProjectFlag == "" || *gcloudBucketFlag == "" {
+	if *providerFlag != "gce" && *providerFlag != "local" && *providerFlag != "mem" {
+		fmt.Printf("Flag '-provider' requires one of the three values: 'gce', 'local', or 'mem'.\n")
+		os.Exit(1)
+	}
+
+	if *spawnConcurrencyFlag < 1 || *providerBurstFlag < 1 {
+		fmt.Printf("Flags '-spawnConcurrency' and '-providerBurst' require values of at least 1.\n")
+		os.Exit(1)
+	}
+
+	// Workers in network namespaces reach the operator
+	// via the host's veth ends, thus not on loopback.
+	if (*providerFlag == "local") && *localNetNSFlag {
+
+		internalHost, _, err := net.SplitHostPort(*internalListenAddrFlag)
+		if err != nil || (internalHost != "" && !net.ParseIP(internalHost).IsUnspecified()) {
+			fmt.Printf("Flag '-localNetNS' requires '-internalAddr' to listen on all interfaces (e.g., '0.0.0.0:443').\n")
+			os.Exit(1)
+		}
+	}
+
+	teardownPolicy, err := ParseTeardownPolicy(*teardownPolicyFlag)
+	if err != nil {
+		fmt.Printf("Flag '-teardownPolicy' is invalid: %v\n", err)
+		os.Exit(1)
+	}
+
+	if (*providerFlag == "gce") && (*gcloudServiceAccFlag == "" || *gcloudProjectFlag == "" || *gcloudBucketFlag == "") {
 		fmt.Printf("Missing argument(s), please provide values for all flags: '-gcloudServiceAcc', '-gcloudProject', '-gcloudBucket'.\n")
 		os.Exit(1)
 	}
@@ -112,21 +273,200 @@ func main() {
 		GCloudProject:    *gcloudProjectFlag,
 		GCloudBucket:     *gcloudBucketFlag,
 
+		GCloudAccessToken: *gcloudAccessTokenFlag,
+
 		TLSCertPath: *certPathFlag,
 		TLSKeyPath:  *keyPathFlag,
 
+		RegisterTimeout:  *registerTimeoutFlag,
+		ReadyTimeout:     *readyTimeoutFlag,
+		FinishTimeout:    *finishTimeoutFlag,
+		HeartbeatTimeout: *heartbeatTimeoutFlag,
+
+		CreateRetries:    *createRetriesFlag,
+		CreateBackoff:    *createBackoffFlag,
+		CreateBackoffMax: *createBackoffMaxFlag,
+		ZoneFallback:     *zoneFallbackFlag,
+
+		RespawnAttempts:  *respawnAttemptsFlag,
+		RespawnOtherZone: *respawnOtherZoneFlag,
+
+		PreemptionPollInterval: *preemptionPollIntervalFlag,
+
+		InstanceTTL: *instanceTTLFlag,
+
+		TeardownPolicy: teardownPolicy.String(),
+
+		SpawnConcurrency: *spawnConcurrencyFlag,
+
+		Budget:           *budgetFlag,
+		ExpectedDuration: *expectedDurationFlag,
+
 		InternalListenAddr: *internalListenAddrFlag,
 		PublicListenAddr:   *publicListenAddrFlag,
-		PublicNewChan:      make(chan string),
+		Queue:              NewExpQueue(),
+
+		ExpHooks:    make(map[ExpState][]ExpHook),
+		WorkerHooks: make(map[WorkerState][]WorkerHook),
 
 		ExpInProgress: "",
-		Exps:          make(map[string]*Exp),
 	}
 
+	op.RegisterDefaultHooks()
+
+	if *webhooksFlag != "" {
+
+		secret := *webhookSecretFlag
+		if secret == "" {
+			secret = os.Getenv("ACS_WEBHOOK_SECRET")
+		}
+
+		if secret == "" {
+			fmt.Printf("Flag '-webhooks' requires a secret via '-webhookSecret' or environment variable ACS_WEBHOOK_SECRET.\n")
+			os.Exit(1)
+		}
+
+		op.Notifier = NewNotifier(strings.Split(*webhooksFlag, ","), secret)
+		op.RegisterWebhookHooks()
+	}
+
+	// Keep the operator within the rate limits
+	// of the compute provider's API.
+	var limiter *TokenBucket
+	if *providerRateFlag > 0 {
+		limiter = NewTokenBucket(*providerRateFlag, *providerBurstFlag)
+	}
+
+	if *providerFlag == "gce" {
+
+		op.Provider = &GCEProvider{
+			Project:          op.GCloudProject,
+			ServiceAcc:       op.GCloudServiceAcc,
+			Bucket:           op.GCloudBucket,
+			APIEndpoint:      *gceEndpointFlag,
+			AccessToken:      op.AccessToken,
+			PollInterval:     (2 * time.Second),
+			OperationTimeout: *gceOperationTimeoutFlag,
+			Limiter:          limiter,
+		}
+
+	} else if *providerFlag == "local" {
+
+		localProvider, err := NewLocalProvider(*localScriptFlag, *localDirFlag, *localSkelDirFlag, op.TLSCertPath,
+			*localMetadataPortFlag, *localNetNSFlag)
+		if err != nil {
+			fmt.Printf("Failed preparing local compute provider: %v\n", err)
+			os.Exit(1)
+		}
+
+		op.Provider = localProvider
+		op.LocalBucketDir = localProvider.BucketDir
+
+	} else {
+
+		exhaustedZones := []string{}
+		if *memExhaustedZonesFlag != "" {
+			exhaustedZones = strings.Split(*memExhaustedZonesFlag, ",")
+		}
+
+		op.Provider = NewMemProvider(exhaustedZones, *memPreemptAfterFlag, *memMetadataDirFlag)
+	}
+
+	// Count every call that reaches the provider.
+	op.Provider = &MeteredProvider{Provider: op.Provider}
+
+	if limiter != nil {
+
+		op.Provider = &RateLimitedProvider{
+			Provider: op.Provider,
+			Bucket:   limiter,
+		}
+	}
+
+	if *pricingPathFlag != "" {
+
+		op.Pricing, err = LoadPricing(*pricingPathFlag)
+		if err != nil {
+			fmt.Printf("Failed loading pricing table from %s: %v\n", *pricingPathFlag, err)
+			os.Exit(1)
+		}
+	}
+
+	op.APITokens, err = LoadAPITokens(*tokensPathFlag)
+	if err != nil {
+		fmt.Printf("Failed loading API tokens from %s: %v\n", *tokensPathFlag, err)
+		os.Exit(1)
+	}
+
+	op.Audit, err = OpenAuditLog(*auditLogPathFlag)
+	if err != nil {
+		fmt.Printf("Failed opening audit log at %s: %v\n", *auditLogPathFlag, err)
+		os.Exit(1)
+	}
+
+	if *auditDeniedIntervalFlag <= 0 {
+		fmt.Printf("Flag '-auditDeniedInterval' requires a positive duration.\n")
+		os.Exit(1)
+	}
+	go op.Audit.RunDeniedFlusher(*auditDeniedIntervalFlag)
+
+	// Load all experiments persisted by
+	// previous runs of the operator.
+	op.Store, op.Exps, err = OpenStore(*storePathFlag)
+	if err != nil {
+		fmt.Printf("Failed opening experiment store at %s: %v\n", *storePathFlag, err)
+		os.Exit(1)
+	}
+
+	for expID := range op.Exps {
+
+		exp := op.Exps[expID]
+
+		if exp.State == ExpConcluded {
+			continue
+		}
+
+		if exp.State == ExpQueued {
+
+			// Experiments still waiting to be
+			// started simply go back into the queue.
+			fmt.Printf("[STORE] Recovered queued experiment %s, queueing it again.\n", expID)
+			exp.prepareChans()
+			op.Queue.Push(expID, exp.Priority, exp.QueuedAt)
+
+		} else {
+
+			// All other experiments that did not conclude
+			// were in flight when the previous operator
+			// process died. Tear down all their instances.
+			fmt.Printf("[STORE] Recovered in-flight experiment %s, tearing it down.\n", expID)
+			if exp.State != ExpRecovered {
+				_ = op.EnterExpState(exp, ExpRecovered, "operator restarted")
+			}
+			go op.TeardownRecovered(exp, "operator restart")
+		}
+	}
+
+	if *storeSyncIntervalFlag <= 0 || *storeCompactSizeFlag <= 0 {
+		fmt.Printf("Flags '-storeSyncInterval' and '-storeCompactSize' require positive values.\n")
+		os.Exit(1)
+	}
+	go op.RunStoreMaintenance(*storeSyncIntervalFlag, (*storeCompactSizeFlag * 1024 * 1024))
+
 	// Create goroutine that completely
 	// handles experiment procedure.
 	go op.RunExperiments()
 
+	// Periodically delete instances that
+	// outlived their experiment.
+	if *reapIntervalFlag > 0 {
+		go op.RunReaper(*reapIntervalFlag)
+	}
+
+	if *metricsAddrFlag != "" {
+		go op.RunMetricsSrv(*metricsAddrFlag)
+	}
+
 	// Prepare and listen for API calls on the
 	// internal network endpoint (worker nodes).
 	op.PrepareInternalSrv()
@@ -138,7 +478,7 @@ func main() {
 
 	fmt.Printf("[PUBLIC] Listening on https://%s/public/experiments for API calls regarding experiments...\n", op.PublicListenAddr)
 
-	err := http.ListenAndServeTLS(op.PublicListenAddr, op.TLSCertPath, op.TLSKeyPath, nil)
+	err = http.ListenAndServeTLS(op.PublicListenAddr, op.TLSCertPath, op.TLSKeyPath, nil)
 	if err != nil {
 		fmt.Printf("Failed handling public experiment requests: %v\n", err)
 		os.Exit(1)
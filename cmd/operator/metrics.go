@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/numbleroot/acs-test-bed/cmd/operator/metrics"
+)
+
+// Metrics the operator exports. Experiment and
+// worker states are recomputed on every scrape.
+var (
+	expsByState = metrics.NewGaugeVec("acs_operator_experiments",
+		"Experiments known to the operator by state.", "state")
+	workersByStatus = metrics.NewGaugeVec("acs_operator_workers",
+		"Workers of all not yet concluded experiments by status.", "exp", "status")
+	spawnSeconds = metrics.NewHistogramVec("acs_operator_spawn_duration_seconds",
+		"Time spawning an instance took, including retries and zone fallback.", metrics.DurationBuckets, "outcome")
+	deleteSeconds = metrics.NewHistogramVec("acs_operator_delete_duration_seconds",
+		"Time deleting an instance took.", metrics.DurationBuckets, "outcome")
+	providerCalls = metrics.NewCounterVec("acs_operator_provider_calls_total",
+		"Calls to the compute provider.", "call")
+	providerErrors = metrics.NewCounterVec("acs_operator_provider_errors_total",
+		"Failed calls to the compute provider by class of error.", "call", "class")
+)
+
+// MeteredProvider counts all calls to the
+// wrapped provider and the ones that failed.
+type MeteredProvider struct {
+	Provider Provider
+}
+
+// outcome labels an observation by
+// whether it ended in an error.
+func outcome(err error) string {
+
+	if err != nil {
+		return "failure"
+	}
+
+	return "success"
+}
+
+// count records one call and its error, if any.
+func (mp *MeteredProvider) count(call string, err error) {
+
+	providerCalls.Inc(call)
+
+	if err != nil {
+		providerErrors.Inc(call, string(ClassOf(err)))
+	}
+}
+
+// CreateInstance creates the instance and counts the call.
+func (mp *MeteredProvider) CreateInstance(spec *InstanceSpec) error {
+
+	err := mp.Provider.CreateInstance(spec)
+	mp.count("create", err)
+
+	return err
+}
+
+// DeleteInstance deletes the instance and counts the call.
+func (mp *MeteredProvider) DeleteInstance(zone string, name string) error {
+
+	err := mp.Provider.DeleteInstance(zone, name)
+	mp.count("delete", err)
+
+	return err
+}
+
+// DescribeInstance describes the instance and counts the call.
+func (mp *MeteredProvider) DescribeInstance(zone string, name string) (*Instance, error) {
+
+	inst, err := mp.Provider.DescribeInstance(zone, name)
+	mp.count("describe", err)
+
+	return inst, err
+}
+
+// ListInstances lists all instances and counts the call.
+func (mp *MeteredProvider) ListInstances() ([]*Instance, error) {
+
+	instances, err := mp.Provider.ListInstances()
+	mp.count("list", err)
+
+	return instances, err
+}
+
+// HandlerGetMetrics refreshes the gauges of experiment
+// and worker states and writes all metrics in the
+// Prometheus text exposition format.
+func (op *Operator) HandlerGetMetrics(w http.ResponseWriter, req *http.Request) {
+
+	expsByState.Reset()
+	workersByStatus.Reset()
+
+	op.Lock()
+
+	states := make(map[ExpState]float64)
+	for _, exp := range op.Exps {
+
+		states[exp.State]++
+
+		if exp.Concluded {
+			continue
+		}
+
+		statuses := make(map[WorkerState]float64)
+		for _, workers := range [][]*Worker{exp.Servers, exp.Clients} {
+
+			for i := range workers {
+				statuses[workers[i].Status]++
+			}
+		}
+
+		for status, num := range statuses {
+			workersByStatus.Set(num, exp.ID, string(status))
+		}
+	}
+
+	op.Unlock()
+
+	for state, num := range states {
+		expsByState.Set(num, string(state))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.Default.Expose(w)
+}
+
+// RunMetricsSrv serves all metrics on a plain HTTP
+// endpoint for Prometheus to scrape.
+func (op *Operator) RunMetricsSrv(addr string) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", op.HandlerGetMetrics)
+
+	fmt.Printf("[METRICS] Serving metrics on http://%s/metrics...\n", addr)
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: (10 * time.Second),
+	}
+
+	err := srv.ListenAndServe()
+	if err != nil {
+		fmt.Printf("[METRICS] Failed serving metrics: %v\n", err)
+	}
+}
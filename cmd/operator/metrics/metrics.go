@@ -0,0 +1,325 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metric is anything that can write itself
+// in the Prometheus text exposition format.
+type Metric interface {
+	Expose(w io.Writer)
+}
+
+// Registry holds all metrics
+// exported by one process.
+type Registry struct {
+	sync.Mutex
+	Metrics []Metric
+}
+
+// CounterVec is a family of counters that only go
+// up, one per combination of label values.
+type CounterVec struct {
+	sync.Mutex
+	Name       string
+	Help       string
+	LabelNames []string
+	values     map[string]float64
+}
+
+// GaugeVec is a family of gauges that may
+// take any value, one per combination of
+// label values.
+type GaugeVec struct {
+	sync.Mutex
+	Name       string
+	Help       string
+	LabelNames []string
+	values     map[string]float64
+}
+
+// HistogramVec is a family of histograms that
+// count observations into cumulative buckets,
+// one per combination of label values.
+type HistogramVec struct {
+	sync.Mutex
+	Name       string
+	Help       string
+	LabelNames []string
+	Buckets    []float64
+	histograms map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Default is the registry all metrics
+// of the operator are exported from.
+var Default = &Registry{}
+
+// Buckets in seconds suitable for calls to a cloud
+// provider and broadcasts to many nodes alike.
+var DurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Register adds supplied metrics to the registry.
+func (reg *Registry) Register(metrics ...Metric) {
+
+	reg.Lock()
+	defer reg.Unlock()
+
+	reg.Metrics = append(reg.Metrics, metrics...)
+}
+
+// Expose writes all registered metrics in
+// the order they were registered.
+func (reg *Registry) Expose(w io.Writer) {
+
+	reg.Lock()
+	defer reg.Unlock()
+
+	for i := range reg.Metrics {
+		reg.Metrics[i].Expose(w)
+	}
+}
+
+// NewCounterVec returns a counter family
+// registered with the default registry.
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+
+	counter := &CounterVec{
+		Name:       name,
+		Help:       help,
+		LabelNames: labelNames,
+		values:     make(map[string]float64),
+	}
+	Default.Register(counter)
+
+	return counter
+}
+
+// NewGaugeVec returns a gauge family
+// registered with the default registry.
+func NewGaugeVec(name string, help string, labelNames ...string) *GaugeVec {
+
+	gauge := &GaugeVec{
+		Name:       name,
+		Help:       help,
+		LabelNames: labelNames,
+		values:     make(map[string]float64),
+	}
+	Default.Register(gauge)
+
+	return gauge
+}
+
+// NewHistogramVec returns a histogram family
+// registered with the default registry.
+func NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+
+	hist := &HistogramVec{
+		Name:       name,
+		Help:       help,
+		LabelNames: labelNames,
+		Buckets:    buckets,
+		histograms: make(map[string]*histogram),
+	}
+	Default.Register(hist)
+
+	return hist
+}
+
+// escape makes a label value safe to
+// place between double quotes.
+func escape(value string) string {
+
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, "\"", "\\\"")
+
+	return strings.ReplaceAll(value, "\n", "\\n")
+}
+
+// labelSet renders label names and values as they
+// appear between the braces of a sample, with
+// optional extra pairs appended.
+func labelSet(names []string, values []string, extra ...string) string {
+
+	pairs := make([]string, 0, (len(names) + (len(extra) / 2)))
+
+	for i := range names {
+
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", names[i], escape(value)))
+	}
+
+	for i := 0; (i + 1) < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[i], escape(extra[(i+1)])))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ","))
+}
+
+// formatValue renders a sample value.
+func formatValue(value float64) string {
+
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+
+	return fmt.Sprintf("%g", value)
+}
+
+// sortedKeys returns the label value combinations
+// of a family in a stable order.
+func sortedKeys(values map[string]float64) []string {
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// key joins label values into a map key.
+func key(labelValues []string) string {
+
+	return strings.Join(labelValues, "\x00")
+}
+
+// Inc increments the counter with
+// supplied label values by one.
+func (counter *CounterVec) Inc(labelValues ...string) {
+
+	counter.Add(1, labelValues...)
+}
+
+// Add increments the counter with supplied
+// label values by a non-negative amount.
+func (counter *CounterVec) Add(delta float64, labelValues ...string) {
+
+	if delta < 0 {
+		return
+	}
+
+	counter.Lock()
+	defer counter.Unlock()
+
+	counter.values[key(labelValues)] += delta
+}
+
+// Expose writes all counters of the family.
+func (counter *CounterVec) Expose(w io.Writer) {
+
+	counter.Lock()
+	defer counter.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", counter.Name, counter.Help, counter.Name)
+
+	for _, k := range sortedKeys(counter.values) {
+		fmt.Fprintf(w, "%s%s %s\n", counter.Name, labelSet(counter.LabelNames, strings.Split(k, "\x00")), formatValue(counter.values[k]))
+	}
+}
+
+// Set sets the gauge with supplied
+// label values to value.
+func (gauge *GaugeVec) Set(value float64, labelValues ...string) {
+
+	gauge.Lock()
+	defer gauge.Unlock()
+
+	gauge.values[key(labelValues)] = value
+}
+
+// Reset removes all gauges of the family, e.g.,
+// before they are recomputed from scratch.
+func (gauge *GaugeVec) Reset() {
+
+	gauge.Lock()
+	defer gauge.Unlock()
+
+	gauge.values = make(map[string]float64)
+}
+
+// Expose writes all gauges of the family.
+func (gauge *GaugeVec) Expose(w io.Writer) {
+
+	gauge.Lock()
+	defer gauge.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", gauge.Name, gauge.Help, gauge.Name)
+
+	for _, k := range sortedKeys(gauge.values) {
+		fmt.Fprintf(w, "%s%s %s\n", gauge.Name, labelSet(gauge.LabelNames, strings.Split(k, "\x00")), formatValue(gauge.values[k]))
+	}
+}
+
+// Observe records one observation in the
+// histogram with supplied label values.
+func (hist *HistogramVec) Observe(value float64, labelValues ...string) {
+
+	hist.Lock()
+	defer hist.Unlock()
+
+	h, found := hist.histograms[key(labelValues)]
+	if !found {
+		h = &histogram{counts: make([]uint64, len(hist.Buckets))}
+		hist.histograms[key(labelValues)] = h
+	}
+
+	for i := range hist.Buckets {
+
+		if value <= hist.Buckets[i] {
+			h.counts[i]++
+		}
+	}
+
+	h.count++
+	h.sum += value
+}
+
+// Expose writes the buckets, sum, and count
+// of all histograms of the family.
+func (hist *HistogramVec) Expose(w io.Writer) {
+
+	hist.Lock()
+	defer hist.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", hist.Name, hist.Help, hist.Name)
+
+	keys := make([]string, 0, len(hist.histograms))
+	for k := range hist.histograms {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+
+		h := hist.histograms[k]
+		labelValues := strings.Split(k, "\x00")
+
+		for i := range hist.Buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", hist.Name, labelSet(hist.LabelNames, labelValues, "le", formatValue(hist.Buckets[i])), h.counts[i])
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", hist.Name, labelSet(hist.LabelNames, labelValues, "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", hist.Name, labelSet(hist.LabelNames, labelValues), formatValue(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", hist.Name, labelSet(hist.LabelNames, labelValues), h.count)
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// PairingStrategy decides which logical client
+// converses with which other logical client.
+type PairingStrategy string
+
+// All supported pairing strategies. Same-machine
+// pairs each client with its neighbor on the same
+// machine, the other strategies pick partners at
+// random that are located on a different machine,
+// zone, or continent, respectively.
+const (
+	PairSameMachine    PairingStrategy = "same-machine"
+	PairCrossMachine   PairingStrategy = "cross-machine"
+	PairCrossZone      PairingStrategy = "cross-zone"
+	PairCrossContinent PairingStrategy = "cross-continent"
+)
+
+// continents maps the region prefix of a GCloud
+// zone to the continent the zone is located on.
+var continents = map[string]string{
+	"asia":         "asia",
+	"australia":    "oceania",
+	"europe":       "europe",
+	"northamerica": "north-america",
+	"us":           "north-america",
+	"southamerica": "south-america",
+}
+
+// Pair records the conversation partner of one
+// logical client, where both are located, and
+// which kind of distance lies between them.
+type Pair struct {
+	Client         string `json:"client"`
+	ClientMachine  string `json:"clientMachine"`
+	ClientZone     string `json:"clientZone"`
+	Partner        string `json:"partner"`
+	PartnerMachine string `json:"partnerMachine"`
+	PartnerZone    string `json:"partnerZone"`
+	Type           string `json:"type"`
+}
+
+// logicalClient is one client process
+// run on a client machine.
+type logicalClient struct {
+	Name      string
+	Machine   string
+	Zone      string
+	Continent string
+	Paired    bool
+}
+
+// ValidPairing reports whether the
+// supplied strategy is known.
+func ValidPairing(strategy PairingStrategy) bool {
+
+	return strategy == PairSameMachine || strategy == PairCrossMachine ||
+		strategy == PairCrossZone || strategy == PairCrossContinent
+}
+
+// continentOf returns the continent
+// supplied zone is located on.
+func continentOf(zone string) string {
+
+	continent, found := continents[strings.Split(zone, "-")[0]]
+	if !found {
+		return zone
+	}
+
+	return continent
+}
+
+// pairType classifies the distance between two
+// logical clients into the pairing strategy that
+// would have produced their pair.
+func pairType(a *logicalClient, b *logicalClient) PairingStrategy {
+
+	if a.Machine == b.Machine {
+		return PairSameMachine
+	} else if a.Zone == b.Zone {
+		return PairCrossMachine
+	} else if a.Continent == b.Continent {
+		return PairCrossZone
+	}
+
+	return PairCrossContinent
+}
+
+// satisfies reports whether a pair of clients
+// is at least as far apart as strategy demands.
+func satisfies(strategy PairingStrategy, a *logicalClient, b *logicalClient) bool {
+
+	switch strategy {
+	case PairCrossMachine:
+		return a.Machine != b.Machine
+	case PairCrossZone:
+		return a.Zone != b.Zone
+	case PairCrossContinent:
+		return a.Continent != b.Continent
+	}
+
+	return true
+}
+
+// PairClients assigns every logical client run on
+// the supplied client machines its conversation
+// partner according to strategy. Random strategies
+// draw from a source seeded with seed, thus the
+// same seed reproduces the same pairing. If the
+// strategy cannot be satisfied for some clients,
+// they are paired up regardless and the type of
+// their pair reflects the actual distance.
+func PairClients(machines []*Worker, perMachine int, strategy PairingStrategy, seed int64) ([]*Pair, error) {
+
+	if !ValidPairing(strategy) {
+		return nil, fmt.Errorf("unknown pairing strategy '%s'", strategy)
+	}
+
+	clients := make([]*logicalClient, 0, (len(machines) * perMachine))
+
+	for i := range machines {
+
+		lastClient := machines[i].ID * perMachine
+		firstClient := lastClient - perMachine
+
+		for j := (firstClient + 1); j <= lastClient; j++ {
+			clients = append(clients, &logicalClient{
+				Name:      fmt.Sprintf("client-%05d", j),
+				Machine:   machines[i].Name,
+				Zone:      machines[i].Zone,
+				Continent: continentOf(machines[i].Zone),
+			})
+		}
+	}
+
+	if (len(clients) % 2) != 0 {
+		return nil, fmt.Errorf("%d logical clients cannot be paired up", len(clients))
+	}
+
+	// Same-machine pairing follows the order of
+	// clients, random strategies a shuffled one.
+	if strategy != PairSameMachine {
+
+		rnd := rand.New(rand.NewSource(seed))
+		rnd.Shuffle(len(clients), func(i, j int) {
+			clients[i], clients[j] = clients[j], clients[i]
+		})
+	}
+
+	pairs := make([]*Pair, 0, len(clients))
+
+	for i := range clients {
+
+		if clients[i].Paired {
+			continue
+		}
+
+		// Find the next unpaired client far enough
+		// away, else settle for the next unpaired one.
+		partner := -1
+		for j := (i + 1); j < len(clients); j++ {
+
+			if clients[j].Paired {
+				continue
+			}
+
+			if partner == -1 {
+				partner = j
+			}
+
+			if satisfies(strategy, clients[i], clients[j]) {
+				partner = j
+				break
+			}
+		}
+
+		a := clients[i]
+		b := clients[partner]
+		a.Paired = true
+		b.Paired = true
+
+		kind := string(pairType(a, b))
+
+		pairs = append(pairs, &Pair{
+			Client:         a.Name,
+			ClientMachine:  a.Machine,
+			ClientZone:     a.Zone,
+			Partner:        b.Name,
+			PartnerMachine: b.Machine,
+			PartnerZone:    b.Zone,
+			Type:           kind,
+		}, &Pair{
+			Client:         b.Name,
+			ClientMachine:  b.Machine,
+			ClientZone:     b.Zone,
+			Partner:        a.Name,
+			PartnerMachine: a.Machine,
+			PartnerZone:    a.Zone,
+			Type:           kind,
+		})
+	}
+
+	return pairs, nil
+}
+
+// indexPairs builds the map from each logical
+// client to its partner out of the recorded pairs.
+func (exp *Exp) indexPairs() {
+
+	exp.PartnersMap = make(map[string]string)
+
+	for i := range exp.Pairs {
+		exp.PartnersMap[exp.Pairs[i].Client] = exp.Pairs[i].Partner
+	}
+}
+
+// relocate records that a client machine moved to
+// another zone, e.g., by zone fallback, and updates
+// the type of all pairs it takes part in.
+func (exp *Exp) relocate(machine string, zone string) {
+
+	for i := range exp.Pairs {
+
+		pair := exp.Pairs[i]
+
+		if pair.ClientMachine == machine {
+			pair.ClientZone = zone
+		}
+
+		if pair.PartnerMachine == machine {
+			pair.PartnerZone = zone
+		}
+
+		if pair.ClientMachine == machine || pair.PartnerMachine == machine {
+
+			pair.Type = string(pairType(&logicalClient{
+				Machine:   pair.ClientMachine,
+				Zone:      pair.ClientZone,
+				Continent: continentOf(pair.ClientZone),
+			}, &logicalClient{
+				Machine:   pair.PartnerMachine,
+				Zone:      pair.PartnerZone,
+				Continent: continentOf(pair.PartnerZone),
+			}))
+		}
+	}
+}
+
+// partnerOf returns the conversation partner of
+// the numbered logical client. Experiments persisted
+// before pairings were recorded paired neighbors.
+func (exp *Exp) partnerOf(client int) string {
+
+	partner, found := exp.PartnersMap[fmt.Sprintf("client-%05d", client)]
+	if found {
+		return partner
+	}
+
+	neighbor := client + 1
+	if (client % 2) == 0 {
+		neighbor = client - 1
+	}
+
+	return fmt.Sprintf("client-%05d", neighbor)
+}
+
+// UploadPairing places the pairing of an experiment
+// as 'pairing.json' into its result folder, where
+// calcstats picks it up. If bucketDir is set, it
+// replaces the GCloud bucket the file is uploaded to.
+func (exp *Exp) UploadPairing(bucketDir string) error {
+
+	pairingJSON, err := json.MarshalIndent(exp.Pairs, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return exp.upload(bucketDir, "pairing.json", pairingJSON)
+}
+
+// upload places a file with supplied name and
+// content into the result folder of the experiment,
+// either below the local stand-in bucket folder or
+// in the GCloud bucket.
+func (exp *Exp) upload(bucketDir string, name string, content []byte) error {
+
+	if bucketDir != "" {
+
+		err := os.MkdirAll(filepath.Join(bucketDir, exp.ResultFolder), 0755)
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(filepath.Join(bucketDir, exp.ResultFolder, name), content, 0644)
+	}
+
+	tmpFile, err := ioutil.TempFile("", fmt.Sprintf("*-%s", name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(content)
+	if err != nil {
+		tmpFile.Close()
+		return err
+	}
+	tmpFile.Close()
+
+	// Upload file to GCloud bucket.
+	out, err := exec.Command("/usr/bin/gsutil", "cp", tmpFile.Name(),
+		fmt.Sprintf("gs://acs-eval/%s/%s", exp.ResultFolder, name)).CombinedOutput()
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Contains(out, []byte("completed")) {
+		return fmt.Errorf("uploading %s to GCloud bucket unsuccessful", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Plan is the fully resolved description of
+// what conducting an experiment would do. Values
+// only known once the experiment runs are given
+// as placeholders, so that plans of the same
+// request can be diffed between code versions.
+type Plan struct {
+	System            string            `json:"system"`
+	ClientsPerMachine int               `json:"clientsPerMachine"`
+	Pairing           PairingStrategy   `json:"pairing"`
+	PairingSeed       int64             `json:"pairingSeed"`
+	TeardownPolicy    string            `json:"teardownPolicy"`
+	ClientTolerance   string            `json:"clientTolerance"`
+	Phases            []string          `json:"phases"`
+	Instances         []*PlanInstance   `json:"instances"`
+	Pairs             []*Pair           `json:"pairs"`
+	Files             map[string]string `json:"files"`
+	Cost              *CostEstimate     `json:"cost,omitempty"`
+}
+
+// PlanInstance describes one instance
+// the plan of an experiment creates.
+type PlanInstance struct {
+	Name              string            `json:"name"`
+	TypeOfNode        string            `json:"typeOfNode"`
+	Zone              string            `json:"zone"`
+	MachineType       string            `json:"machineType"`
+	MinCPUPlatform    string            `json:"minCPUPlatform"`
+	SourceImage       string            `json:"sourceImage"`
+	DiskType          string            `json:"diskType"`
+	DiskSize          string            `json:"diskSize"`
+	PubliclyReachable bool              `json:"publiclyReachable"`
+	Preemptible       bool              `json:"preemptible"`
+	DependsOn         []string          `json:"dependsOn,omitempty"`
+	Labels            map[string]string `json:"labels"`
+	Metadata          []*MetadataItem   `json:"metadata"`
+}
+
+// Phases lists the phases ConductExp
+// drives an experiment through, in order.
+func (exp *Exp) Phases() []string {
+
+	phases := make([]string, 0, 12)
+
+	if exp.System == "zeno" {
+		phases = append(phases, "launch zeno PKI")
+	}
+
+	phases = append(phases, "spawn servers", "server registration")
+
+	if exp.System == "vuvuzela" {
+		phases = append(phases, "produce and upload pki.conf")
+	}
+
+	phases = append(phases, "server initialization", "spawn clients", "client registration",
+		"client initialization", "upload pairing.json")
+
+	if exp.System == "zeno" {
+		phases = append(phases, "start zeno PKI broadcast")
+	}
+
+	return append(phases, "execution", "await shutdown confirmation", "tear down clients", "tear down servers")
+}
+
+// PlanExp resolves everything conducting supplied
+// experiment would do without touching the cloud.
+func (op *Operator) PlanExp(exp *Exp, expectedDuration string) (*Plan, error) {
+
+	cost, err := op.EstimateCost(exp, expectedDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stand in for everything that is
+	// only known once the experiment runs.
+	exp.ID = "{assigned on submission}"
+
+	for _, workers := range [][]*Worker{exp.Servers, exp.Clients} {
+
+		for i := range workers {
+			workers[i].Address = fmt.Sprintf("{address of %s}", workers[i].Name)
+			workers[i].Token = "{minted on spawn}"
+		}
+	}
+
+	plan := &Plan{
+		System:            exp.System,
+		ClientsPerMachine: exp.ClientsPerMachine,
+		Pairing:           exp.Pairing,
+		PairingSeed:       exp.PairingSeed,
+		TeardownPolicy:    exp.TeardownPolicy,
+		ClientTolerance:   exp.ClientTolerance,
+		Phases:            exp.Phases(),
+		Instances:         make([]*PlanInstance, 0, (len(exp.Servers) + len(exp.Clients))),
+		Pairs:             exp.Pairs,
+		Files:             make(map[string]string),
+		Cost:              cost,
+	}
+
+	deps := spawnDeps(exp)
+
+	// Servers are reachable from the
+	// Internet, clients are not.
+	addInstances := func(workers []*Worker, publiclyReachable bool) {
+
+		for i := range workers {
+
+			spec := op.InstanceSpec(exp, workers[i], publiclyReachable)
+
+			plan.Instances = append(plan.Instances, &PlanInstance{
+				Name:              workers[i].Name,
+				TypeOfNode:        workers[i].TypeOfNode,
+				Zone:              workers[i].Zone,
+				MachineType:       workers[i].MachineType,
+				MinCPUPlatform:    workers[i].MinCPUPlatform,
+				SourceImage:       workers[i].SourceImage,
+				DiskType:          workers[i].DiskType,
+				DiskSize:          workers[i].DiskSize,
+				PubliclyReachable: publiclyReachable,
+				Preemptible:       workers[i].Preemptible,
+				DependsOn:         deps[workers[i].Name],
+				Labels:            spec.Labels,
+				Metadata:          spec.Metadata,
+			})
+		}
+	}
+
+	addInstances(exp.Servers, true)
+	addInstances(exp.Clients, false)
+
+	if exp.System == "vuvuzela" {
+
+		pki, err := exp.VuvuzelaPKI()
+		if err != nil {
+			return nil, fmt.Errorf("producing pki.conf failed: %v", err)
+		}
+
+		plan.Files["vuvuzela-confs/pki.conf"] = string(pki)
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// preempted reports whether the provider status of
+// an instance shows that it was taken away, as GCE
+// does with preemptible instances it reclaims.
+func preempted(inst *Instance) bool {
+
+	return inst.Status == "STOPPING" || inst.Status == "TERMINATED"
+}
+
+// WatchPreemptions polls the provider for the status of
+// all preemptible client instances of an experiment and
+// reports each one that was preempted via the experiment's
+// preempted channel. Each poll lists the instances once and
+// picks those labelled with the experiment. Experiments
+// without preemptible clients are not watched.
+func (op *Operator) WatchPreemptions(exp *Exp, stop chan struct{}) {
+
+	if !exp.PreemptibleClients || op.PreemptionPollInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(op.PreemptionPollInterval)
+	defer ticker.Stop()
+
+	for {
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		// Collect all instances that
+		// might be running right now.
+		watched := make(map[string]*Worker)
+
+		op.Lock()
+		for i := range exp.Clients {
+
+			worker := exp.Clients[i]
+			if !worker.Preemptible || !worker.Spawned {
+				continue
+			}
+
+			if worker.Status != WorkerPending && worker.Status != WorkerRegistered && worker.Status != WorkerReady {
+				continue
+			}
+
+			watched[worker.InstanceName()] = worker
+		}
+		op.Unlock()
+
+		if len(watched) == 0 {
+			continue
+		}
+
+		instances, err := op.Provider.ListInstances()
+		if err != nil {
+			fmt.Printf("[PREEMPTION] Listing instances of experiment %s failed: %v\n", exp.ID, err)
+			continue
+		}
+
+		for _, inst := range instances {
+
+			if inst.Labels[ExpLabel] != exp.ID || !preempted(inst) {
+				continue
+			}
+
+			worker, found := watched[inst.Name]
+			if !found {
+				continue
+			}
+
+			// Skip workers whose instance got
+			// replaced while polling the provider.
+			op.Lock()
+			current := worker.InstanceName() == inst.Name
+			op.Unlock()
+
+			if !current {
+				continue
+			}
+
+			select {
+			case exp.PreemptedChan <- worker:
+			case <-stop:
+				return
+			}
+		}
+	}
+}
+
+// HandlePreemption marks a worker whose instance got
+// preempted and either replaces its instance, if it
+// was not ready yet and has attempts left, or counts
+// it against the experiment's failure tolerance. It
+// returns the reason for failing the experiment if
+// the latter does not hold anymore.
+func (op *Operator) HandlePreemption(exp *Exp, worker *Worker) string {
+
+	respawn := op.mayRespawn(exp, worker, WorkerPending, WorkerRegistered)
+
+	err := op.EnterWorkerState(exp, worker, WorkerPreempted, fmt.Sprintf("instance %s preempted", worker.InstanceName()))
+	if err != nil {
+		return ""
+	}
+
+	if respawn {
+		op.Respawn(exp, worker, "preempted")
+		return ""
+	}
+
+	return op.BeyondTolerance(exp)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hours GCloud bills a month of
+// persistent disk storage for.
+const hoursPerMonth = 730.0
+
+// Pricing maps each machine type to its price per
+// hour and each disk type to its price per GB and
+// month. Prices are keyed by zone, region, or the
+// fallback key 'default', in this order of precedence.
+// Preemptible machine types are priced separately, if
+// listed, and else at the regular price.
+type Pricing struct {
+	Currency                string                        `json:"currency"`
+	MachineTypes            map[string]map[string]float64 `json:"machineTypes"`
+	PreemptibleMachineTypes map[string]map[string]float64 `json:"preemptibleMachineTypes,omitempty"`
+	DiskTypes               map[string]map[string]float64 `json:"diskTypes"`
+}
+
+// CostEstimate is the expected cost of
+// the instances of one experiment.
+type CostEstimate struct {
+	Currency   string  `json:"currency"`
+	PerHour    float64 `json:"perHour"`
+	Hours      float64 `json:"hours"`
+	PerRun     float64 `json:"perRun"`
+	Budget     float64 `json:"budget,omitempty"`
+	OverBudget bool    `json:"overBudget,omitempty"`
+}
+
+// LoadPricing reads the pricing table
+// from the JSON file at supplied path.
+func LoadPricing(path string) (*Pricing, error) {
+
+	pricingJSON, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pricing := &Pricing{}
+	err = json.Unmarshal(pricingJSON, pricing)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pricing.MachineTypes) == 0 {
+		return nil, fmt.Errorf("pricing table lists no machine types")
+	}
+
+	return pricing, nil
+}
+
+// priceIn looks up the price for supplied
+// zone, falling back to its region and
+// then to the default price.
+func priceIn(prices map[string]float64, zone string) (float64, bool) {
+
+	price, found := prices[zone]
+	if found {
+		return price, true
+	}
+
+	sep := strings.LastIndex(zone, "-")
+	if sep != -1 {
+
+		price, found = prices[zone[:sep]]
+		if found {
+			return price, true
+		}
+	}
+
+	price, found = prices["default"]
+
+	return price, found
+}
+
+// PerHour returns the price of running the
+// instance of supplied worker for one hour.
+func (pricing *Pricing) PerHour(worker *Worker) (float64, error) {
+
+	machinePrice, found := priceIn(pricing.MachineTypes[worker.MachineType], worker.Zone)
+	if worker.Preemptible {
+
+		preemptiblePrice, preemptibleFound := priceIn(pricing.PreemptibleMachineTypes[worker.MachineType], worker.Zone)
+		if preemptibleFound {
+			machinePrice, found = preemptiblePrice, true
+		}
+	}
+
+	if !found {
+		return 0, fmt.Errorf("no price for machine type '%s' in zone %s", worker.MachineType, worker.Zone)
+	}
+
+	diskPrice, found := priceIn(pricing.DiskTypes[worker.DiskType], worker.Zone)
+	if !found {
+		return 0, fmt.Errorf("no price for disk type '%s' in zone %s", worker.DiskType, worker.Zone)
+	}
+
+	diskSize, err := strconv.ParseFloat(worker.DiskSize, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid disk size '%s' of %s", worker.DiskSize, worker.Name)
+	}
+
+	return machinePrice + ((diskPrice * diskSize) / hoursPerMonth), nil
+}
+
+// Estimate returns the cost of running the instances
+// of all supplied workers for the expected duration.
+func (pricing *Pricing) Estimate(workers []*Worker, duration time.Duration) (*CostEstimate, error) {
+
+	estimate := &CostEstimate{
+		Currency: pricing.Currency,
+		Hours:    duration.Hours(),
+	}
+
+	for i := range workers {
+
+		perHour, err := pricing.PerHour(workers[i])
+		if err != nil {
+			return nil, err
+		}
+
+		estimate.PerHour += perHour
+	}
+
+	estimate.PerRun = estimate.PerHour * estimate.Hours
+
+	return estimate, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// ErrorClass tells the operator how to
+// react to a failed call to a provider.
+type ErrorClass string
+
+// Transient errors are worth retrying as is, quota
+// errors (exhausted quota or zone capacity) might
+// disappear in another zone, and permanent errors
+// will not go away by trying again. Exists errors
+// report that an instance to create is already there,
+// e.g., because an earlier attempt reached the provider
+// even though it looked failed to the operator. Not-found
+// errors report that an instance to delete is unknown.
+const (
+	ErrTransient ErrorClass = "transient"
+	ErrQuota     ErrorClass = "quota"
+	ErrPermanent ErrorClass = "permanent"
+	ErrExists    ErrorClass = "exists"
+	ErrNotFound  ErrorClass = "not-found"
+)
+
+// ProviderError wraps an error returned
+// by a provider together with its class.
+type ProviderError struct {
+	Class ErrorClass
+	Err   error
+}
+
+// Error returns the wrapped error
+// prefixed with its class.
+func (pErr *ProviderError) Error() string {
+
+	return fmt.Sprintf("%s error: %v", pErr.Class, pErr.Err)
+}
+
+// ClassOf returns the class of an error returned
+// by a provider. Errors the provider did not
+// classify are assumed to be transient.
+func ClassOf(err error) ErrorClass {
+
+	pErr, ok := err.(*ProviderError)
+	if !ok {
+		return ErrTransient
+	}
+
+	return pErr.Class
+}
+
+// Instance describes one compute instance
+// as reported back by a compute provider.
+type Instance struct {
+	Name    string            `json:"name"`
+	Zone    string            `json:"zone"`
+	Status  string            `json:"status"`
+	Labels  map[string]string `json:"labels"`
+	Created time.Time         `json:"created"`
+}
+
+// copyLabels returns a copy of supplied labels
+// that is safe to hand out to callers.
+func copyLabels(labels map[string]string) map[string]string {
+
+	copied := make(map[string]string)
+	for key, value := range labels {
+		copied[key] = value
+	}
+
+	return copied
+}
+
+// MetadataItem is one key-value pair handed
+// to a compute instance for consumption by
+// its startup script.
+type MetadataItem struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// InstanceSpec bundles everything a compute
+// provider needs to know in order to create
+// the instance for one worker of an experiment.
+// Providers without support for labels or
+// preemptible instances ignore these fields.
+type InstanceSpec struct {
+	Name              string
+	Worker            *Worker
+	PubliclyReachable bool
+	Preemptible       bool
+	Labels            map[string]string
+	Metadata          []*MetadataItem
+}
+
+// Provider abstracts over the compute backend
+// the operator provisions worker instances on.
+// All calls block until the backend has either
+// carried out the action or returned an error.
+type Provider interface {
+
+	// CreateInstance provisions and boots the
+	// instance described by supplied spec. It
+	// makes one attempt only and reports failures
+	// as ProviderError where it can tell their class.
+	CreateInstance(spec *InstanceSpec) error
+
+	// DeleteInstance shuts down and subsequently
+	// removes the named instance in zone. Deleting
+	// an instance that does not exist fails with a
+	// not-found error, which callers take as deleted,
+	// as its creation might have failed.
+	DeleteInstance(zone string, name string) error
+
+	// DescribeInstance returns the current state
+	// of the named instance in zone.
+	DescribeInstance(zone string, name string) (*Instance, error)
+
+	// ListInstances returns all instances the
+	// provider currently knows about.
+	ListInstances() ([]*Instance, error)
+}
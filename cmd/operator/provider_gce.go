@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GCEProvider provisions worker instances
+// via the REST API of Google Compute Engine.
+// If set, Limiter is the token bucket shared
+// with the rate-limited provider wrapping this
+// one, which also throttles all API calls made
+// within one provider call beyond the first.
+type GCEProvider struct {
+	Project          string
+	ServiceAcc       string
+	Bucket           string
+	APIEndpoint      string
+	AccessToken      func() string
+	PollInterval     time.Duration
+	OperationTimeout time.Duration
+	Limiter          *TokenBucket
+}
+
+// gceInstance captures the parts of a GCE
+// instance resource the operator cares about.
+type gceInstance struct {
+	Name              string            `json:"name"`
+	Zone              string            `json:"zone"`
+	Status            string            `json:"status"`
+	Labels            map[string]string `json:"labels"`
+	CreationTimestamp string            `json:"creationTimestamp"`
+}
+
+// gceInstanceList is the response format of
+// the aggregated instances list API call.
+type gceInstanceList struct {
+	Items map[string]struct {
+		Instances []*gceInstance `json:"instances"`
+	} `json:"items"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// toInstance converts the API representation of
+// an instance into the provider-agnostic one.
+func (inst *gceInstance) toInstance() *Instance {
+
+	// Zones are returned as full resource URLs,
+	// only keep the zone's name.
+	zoneParts := strings.Split(inst.Zone, "/")
+
+	// Instances whose creation time cannot be
+	// parsed are treated as created just now.
+	created, err := time.Parse(time.RFC3339, inst.CreationTimestamp)
+	if err != nil {
+		created = time.Now()
+	}
+
+	return &Instance{
+		Name:    inst.Name,
+		Zone:    zoneParts[(len(zoneParts) - 1)],
+		Status:  inst.Status,
+		Labels:  inst.Labels,
+		Created: created,
+	}
+}
+
+// throttle waits for a token of the shared
+// bucket before a follow-up API call, if
+// rate limiting is enabled.
+func (gce *GCEProvider) throttle() {
+
+	if gce.Limiter != nil {
+		gce.Limiter.Wait()
+	}
+}
+
+// do sends an authorized request with optional
+// JSON body to the GCE API and returns the
+// response body.
+func (gce *GCEProvider) do(method string, endpoint string, body string) ([]byte, error) {
+
+	// Create HTTP request.
+	request, err := http.NewRequest(method, endpoint, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set(http.CanonicalHeaderKey("authorization"), fmt.Sprintf("Bearer %s", gce.AccessToken()))
+
+	if body != "" {
+		request.Header.Set(http.CanonicalHeaderKey("content-type"), "application/json")
+	}
+
+	// Send the request to GCP.
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Read the response.
+	return ioutil.ReadAll(resp.Body)
+}
+
+// CreateInstance builds and validates the insert
+// request for supplied spec, instructs GCP to create
+// the instance, and waits for the operation to end.
+func (gce *GCEProvider) CreateInstance(spec *InstanceSpec) error {
+
+	worker := spec.Worker
+
+	// Customize API endpoint to send request to.
+	endpoint := fmt.Sprintf("%s/projects/%s/zones/%s/instances", gce.APIEndpoint, gce.Project, worker.Zone)
+
+	// Prepare request body.
+	insertReq := gce.InsertRequest(spec)
+
+	err := insertReq.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid create API request: %v", err)
+	}
+
+	reqBodyJSON, err := json.Marshal(insertReq)
+	if err != nil {
+		return err
+	}
+	reqBody := string(reqBodyJSON)
+
+	// Send the request to GCP and wait for
+	// the instance to have been created.
+	operation, err := gce.startOperation(http.MethodPost, endpoint, reqBody)
+	if err != nil {
+		return err
+	}
+
+	return gce.waitOperation(operation)
+}
+
+// DeleteInstance instructs GCP to shut down and
+// subsequently delete an instance, and waits for
+// the operation to end. It makes one attempt only.
+// GCP not knowing about the instance in zone is
+// reported as not-found error.
+func (gce *GCEProvider) DeleteInstance(zone string, name string) error {
+
+	endpoint := fmt.Sprintf("%s/projects/%s/zones/%s/instances/%s", gce.APIEndpoint, gce.Project, zone, name)
+
+	// Send the request to GCP.
+	operation, err := gce.startOperation(http.MethodDelete, endpoint, "")
+	if err == nil {
+		err = gce.waitOperation(operation)
+	}
+
+	if gceNotFound(err) {
+		return &ProviderError{
+			Class: ErrNotFound,
+			Err:   err.(*ProviderError).Err,
+		}
+	}
+
+	return err
+}
+
+// DescribeInstance retrieves the current
+// state of an instance from GCP.
+func (gce *GCEProvider) DescribeInstance(zone string, name string) (*Instance, error) {
+
+	endpoint := fmt.Sprintf("%s/projects/%s/zones/%s/instances/%s", gce.APIEndpoint, gce.Project, zone, name)
+
+	outRaw, err := gce.do(http.MethodGet, endpoint, "")
+	if err != nil {
+		return nil, err
+	}
+
+	inst := &gceInstance{}
+	err = json.Unmarshal(outRaw, inst)
+	if err != nil {
+		return nil, err
+	}
+
+	if inst.Name == "" {
+		return nil, fmt.Errorf("describe API request returned failure message: '%s'", outRaw)
+	}
+
+	return inst.toInstance(), nil
+}
+
+// ListInstances retrieves all instances in the
+// project across all zones from GCP.
+func (gce *GCEProvider) ListInstances() ([]*Instance, error) {
+
+	instances := make([]*Instance, 0, 50)
+	pageToken := ""
+
+	for {
+
+		endpoint := fmt.Sprintf("%s/projects/%s/aggregated/instances", gce.APIEndpoint, gce.Project)
+		if pageToken != "" {
+			endpoint = fmt.Sprintf("%s?pageToken=%s", endpoint, pageToken)
+			gce.throttle()
+		}
+
+		outRaw, err := gce.do(http.MethodGet, endpoint, "")
+		if err != nil {
+			return nil, err
+		}
+
+		// An error response, e.g., due to an expired
+		// token, must not look like zero instances.
+		apiErr := &gceError{}
+		err = json.Unmarshal(outRaw, apiErr)
+		if err != nil {
+			return nil, err
+		}
+
+		if apiErr.Error != nil {
+
+			opErr := &gceOperationError{
+				StatusCode: apiErr.Error.Code,
+				Message:    apiErr.Error.Message,
+				Errors:     apiErr.Error.Errors,
+			}
+
+			return nil, &ProviderError{Class: opErr.class(), Err: opErr}
+		}
+
+		list := &gceInstanceList{}
+		err = json.Unmarshal(outRaw, list)
+		if err != nil {
+			return nil, err
+		}
+
+		for zone := range list.Items {
+
+			for _, inst := range list.Items[zone].Instances {
+				instances = append(instances, inst.toInstance())
+			}
+		}
+
+		// Continue with next page, if there is one.
+		pageToken = list.NextPageToken
+		if pageToken == "" {
+			break
+		}
+	}
+
+	return instances, nil
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// gceErrorDetail describes one cause of a failed API
+// call or operation. API errors name it a reason,
+// operation errors a code.
+type gceErrorDetail struct {
+	Reason   string `json:"reason"`
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	Message  string `json:"message"`
+}
+
+// gceError is the format of error
+// responses of the API itself.
+type gceError struct {
+	Error *struct {
+		Code    int               `json:"code"`
+		Message string            `json:"message"`
+		Errors  []*gceErrorDetail `json:"errors"`
+	} `json:"error"`
+}
+
+// gceOperation is the zone operation resource
+// returned by all mutating API calls.
+type gceOperation struct {
+	Kind                string `json:"kind"`
+	Name                string `json:"name"`
+	Zone                string `json:"zone"`
+	OperationType       string `json:"operationType"`
+	TargetLink          string `json:"targetLink"`
+	Status              string `json:"status"`
+	Progress            int    `json:"progress"`
+	HTTPErrorStatusCode int    `json:"httpErrorStatusCode"`
+	HTTPErrorMessage    string `json:"httpErrorMessage"`
+	Error               *struct {
+		Errors []*gceErrorDetail `json:"errors"`
+	} `json:"error"`
+}
+
+// gceOperationError reports a failed API call or
+// operation together with all causes GCP named.
+type gceOperationError struct {
+	Operation  string
+	Type       string
+	Target     string
+	StatusCode int
+	Message    string
+	Errors     []*gceErrorDetail
+}
+
+// Reasons and codes of GCE errors that signal an
+// exhausted quota or a zone out of capacity.
+var gceQuotaReasons = map[string]bool{
+	"quotaExceeded":                             true,
+	"QUOTA_EXCEEDED":                            true,
+	"ZONE_RESOURCE_POOL_EXHAUSTED":              true,
+	"ZONE_RESOURCE_POOL_EXHAUSTED_WITH_DETAILS": true,
+}
+
+// Reasons and codes of GCE errors signaling
+// that the resource to create already exists.
+var gceExistsReasons = map[string]bool{
+	"alreadyExists":           true,
+	"RESOURCE_ALREADY_EXISTS": true,
+}
+
+// Reasons and codes of GCE errors signaling
+// that the resource to act on does not exist.
+var gceNotFoundReasons = map[string]bool{
+	"notFound":           true,
+	"RESOURCE_NOT_FOUND": true,
+}
+
+// Reasons and codes of GCE
+// errors worth retrying.
+var gceTransientReasons = map[string]bool{
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+	"backendError":          true,
+	"internalError":         true,
+	"RESOURCE_NOT_READY":    true,
+}
+
+// Error lists all causes of the failure.
+func (opErr *gceOperationError) Error() string {
+
+	causes := make([]string, 0, len(opErr.Errors))
+	for _, detail := range opErr.Errors {
+
+		code := detail.Code
+		if code == "" {
+			code = detail.Reason
+		}
+
+		causes = append(causes, fmt.Sprintf("%s: %s", code, detail.Message))
+	}
+
+	if len(causes) == 0 {
+		causes = append(causes, opErr.Message)
+	}
+
+	if opErr.Operation == "" {
+		return fmt.Sprintf("API request failed with status %d (%s)", opErr.StatusCode, strings.Join(causes, "; "))
+	}
+
+	return fmt.Sprintf("%s operation %s on %s failed with status %d (%s)", opErr.Type, opErr.Operation,
+		lastSegment(opErr.Target), opErr.StatusCode, strings.Join(causes, "; "))
+}
+
+// class determines how the operator
+// should react to the failure.
+func (opErr *gceOperationError) class() ErrorClass {
+
+	for _, detail := range opErr.Errors {
+
+		if gceQuotaReasons[detail.Reason] || gceQuotaReasons[detail.Code] {
+			return ErrQuota
+		}
+
+		if gceExistsReasons[detail.Reason] || gceExistsReasons[detail.Code] {
+			return ErrExists
+		}
+
+		if gceTransientReasons[detail.Reason] || gceTransientReasons[detail.Code] {
+			return ErrTransient
+		}
+	}
+
+	if opErr.StatusCode == http.StatusTooManyRequests || opErr.StatusCode >= 500 {
+		return ErrTransient
+	}
+
+	return ErrPermanent
+}
+
+// gceNotFound reports whether supplied error
+// of an API call or operation says that the
+// resource to act on does not exist.
+func gceNotFound(err error) bool {
+
+	pErr, ok := err.(*ProviderError)
+	if !ok {
+		return false
+	}
+
+	opErr, ok := pErr.Err.(*gceOperationError)
+	if !ok {
+		return false
+	}
+
+	if opErr.StatusCode == http.StatusNotFound {
+		return true
+	}
+
+	for _, detail := range opErr.Errors {
+
+		if gceNotFoundReasons[detail.Reason] || gceNotFoundReasons[detail.Code] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lastSegment returns the name at the end of
+// a resource URL, e.g., the zone of a zone URL.
+func lastSegment(url string) string {
+
+	parts := strings.Split(url, "/")
+
+	return parts[(len(parts) - 1)]
+}
+
+// startOperation sends a mutating request to the GCE
+// API and returns the operation it started. Failures
+// are reported as classified ProviderError.
+func (gce *GCEProvider) startOperation(method string, endpoint string, body string) (*gceOperation, error) {
+
+	// Failing to reach the API at
+	// all is worth trying again.
+	outRaw, err := gce.do(method, endpoint, body)
+	if err != nil {
+		return nil, &ProviderError{
+			Class: ErrTransient,
+			Err:   fmt.Errorf("%s request failed: %v", method, err),
+		}
+	}
+
+	apiErr := &gceError{}
+	err = json.Unmarshal(outRaw, apiErr)
+	if err != nil {
+		return nil, &ProviderError{
+			Class: ErrTransient,
+			Err:   fmt.Errorf("%s request returned unparsable response '%s': %v", method, outRaw, err),
+		}
+	}
+
+	if apiErr.Error != nil {
+
+		opErr := &gceOperationError{
+			StatusCode: apiErr.Error.Code,
+			Message:    apiErr.Error.Message,
+			Errors:     apiErr.Error.Errors,
+		}
+
+		return nil, &ProviderError{Class: opErr.class(), Err: opErr}
+	}
+
+	operation := &gceOperation{}
+	err = json.Unmarshal(outRaw, operation)
+	if err != nil || operation.Name == "" {
+		return nil, &ProviderError{
+			Class: ErrPermanent,
+			Err:   fmt.Errorf("%s request returned no operation: '%s'", method, outRaw),
+		}
+	}
+
+	return operation, nil
+}
+
+// waitOperation polls the supplied zone operation until
+// it is done and returns its errors, if any, as classified
+// ProviderError. Operations not done within the provider's
+// timeout count as transient failure.
+func (gce *GCEProvider) waitOperation(operation *gceOperation) error {
+
+	endpoint := fmt.Sprintf("%s/projects/%s/zones/%s/operations/%s", gce.APIEndpoint, gce.Project,
+		lastSegment(operation.Zone), operation.Name)
+	deadline := time.Now().Add(gce.OperationTimeout)
+
+	for operation.Status != "DONE" {
+
+		if time.Now().After(deadline) {
+			return &ProviderError{
+				Class: ErrTransient,
+				Err: fmt.Errorf("%s operation %s on %s not done after %s", operation.OperationType,
+					operation.Name, lastSegment(operation.TargetLink), gce.OperationTimeout),
+			}
+		}
+
+		time.Sleep(gce.PollInterval)
+		gce.throttle()
+
+		// Keep the last known state if polling fails,
+		// the operation proceeds in any case.
+		outRaw, err := gce.do(http.MethodGet, endpoint, "")
+		if err != nil {
+			fmt.Printf("[GCE] Polling operation %s failed (will try again): %v\n", operation.Name, err)
+			continue
+		}
+
+		polled := &gceOperation{}
+		err = json.Unmarshal(outRaw, polled)
+		if err != nil || polled.Name == "" {
+			fmt.Printf("[GCE] Polling operation %s returned unexpected response (will try again): '%s'\n", operation.Name, outRaw)
+			continue
+		}
+
+		operation = polled
+	}
+
+	if operation.Error == nil || len(operation.Error.Errors) == 0 {
+		return nil
+	}
+
+	opErr := &gceOperationError{
+		Operation:  operation.Name,
+		Type:       operation.OperationType,
+		Target:     operation.TargetLink,
+		StatusCode: operation.HTTPErrorStatusCode,
+		Message:    operation.HTTPErrorMessage,
+		Errors:     operation.Error.Errors,
+	}
+
+	return &ProviderError{Class: opErr.class(), Err: opErr}
+}
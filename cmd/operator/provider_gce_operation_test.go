@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResponse is one canned answer
+// of the fake GCE API.
+type fakeResponse struct {
+	Status int
+	Body   string
+}
+
+// fakeGCE stands in for the GCE API. Mutating calls
+// get the start response, polls of the operation get
+// the next of the poll responses, repeating the last.
+type fakeGCE struct {
+	sync.Mutex
+	Start fakeResponse
+	Polls []fakeResponse
+	polls int
+}
+
+// ServeHTTP answers one call to the fake API.
+func (fake *fakeGCE) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	fake.Lock()
+	defer fake.Unlock()
+
+	if req.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, apiErrorJSON(http.StatusUnauthorized, "authError"))
+		return
+	}
+
+	resp := fake.Start
+
+	if strings.Contains(req.URL.Path, "/operations/") {
+
+		i := fake.polls
+		if i >= len(fake.Polls) {
+			i = len(fake.Polls) - 1
+		}
+		fake.polls++
+
+		resp = fake.Polls[i]
+	}
+
+	w.WriteHeader(resp.Status)
+	fmt.Fprint(w, resp.Body)
+}
+
+// Polled returns how often the operation was polled.
+func (fake *fakeGCE) Polled() int {
+
+	fake.Lock()
+	defer fake.Unlock()
+
+	return fake.polls
+}
+
+// operationJSON renders a zone operation in supplied
+// status, failed with supplied codes if any.
+func operationJSON(status string, httpStatus int, codes ...string) fakeResponse {
+
+	op := map[string]interface{}{
+		"kind":          "compute#operation",
+		"name":          "operation-1",
+		"zone":          "https://www.googleapis.com/compute/v1/projects/acs-eval/zones/europe-west1-b",
+		"operationType": "insert",
+		"targetLink":    "https://www.googleapis.com/compute/v1/projects/acs-eval/zones/europe-west1-b/instances/client-00001",
+		"status":        status,
+	}
+
+	if len(codes) > 0 {
+
+		errs := make([]map[string]string, len(codes))
+		for i := range codes {
+			errs[i] = map[string]string{"code": codes[i], "message": fmt.Sprintf("%s happened", codes[i])}
+		}
+
+		op["httpErrorStatusCode"] = httpStatus
+		op["httpErrorMessage"] = http.StatusText(httpStatus)
+		op["error"] = map[string]interface{}{"errors": errs}
+	}
+
+	body, _ := json.Marshal(op)
+
+	return fakeResponse{Status: http.StatusOK, Body: string(body)}
+}
+
+// apiErrorJSON renders an error response
+// of the API itself with supplied reason.
+func apiErrorJSON(status int, reason string) string {
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": fmt.Sprintf("%s happened", reason),
+			"errors": []map[string]string{
+				{"reason": reason, "message": fmt.Sprintf("%s happened", reason)},
+			},
+		},
+	})
+
+	return string(body)
+}
+
+// newFakeGCEProvider starts a fake GCE API and returns
+// a provider talking to it, and a function to stop it.
+func newFakeGCEProvider(fake *fakeGCE, timeout time.Duration) (*GCEProvider, func()) {
+
+	srv := httptest.NewServer(fake)
+
+	gce := testGCEProvider()
+	gce.APIEndpoint = srv.URL
+	gce.AccessToken = func() string { return "token" }
+	gce.PollInterval = time.Millisecond
+	gce.OperationTimeout = timeout
+
+	return gce, srv.Close
+}
+
+func TestWaitOperationSequence(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		polls  []fakeResponse
+		class  ErrorClass
+		polled int
+	}{
+		{"pending running done", []fakeResponse{
+			operationJSON("RUNNING", 0),
+			operationJSON("RUNNING", 0),
+			operationJSON("DONE", 0),
+		}, "", 3},
+		{"flaky poll", []fakeResponse{
+			{Status: http.StatusServiceUnavailable, Body: "unavailable"},
+			operationJSON("DONE", 0),
+		}, "", 2},
+		{"done with quota error", []fakeResponse{
+			operationJSON("RUNNING", 0),
+			operationJSON("DONE", http.StatusServiceUnavailable, "ZONE_RESOURCE_POOL_EXHAUSTED"),
+		}, ErrQuota, 2},
+		{"done with quota error among others", []fakeResponse{
+			operationJSON("DONE", http.StatusForbidden, "INVALID_USAGE", "QUOTA_EXCEEDED"),
+		}, ErrQuota, 1},
+		{"done with transient error", []fakeResponse{
+			operationJSON("DONE", http.StatusServiceUnavailable, "INTERNAL_ERROR"),
+		}, ErrTransient, 1},
+		{"done with not ready error", []fakeResponse{
+			operationJSON("DONE", http.StatusBadRequest, "RESOURCE_NOT_READY"),
+		}, ErrTransient, 1},
+		{"done with permanent error", []fakeResponse{
+			operationJSON("DONE", http.StatusBadRequest, "INVALID_FIELD_VALUE"),
+		}, ErrPermanent, 1},
+		{"done with exists error", []fakeResponse{
+			operationJSON("DONE", http.StatusConflict, "RESOURCE_ALREADY_EXISTS"),
+		}, ErrExists, 1},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			fake := &fakeGCE{
+				Start: operationJSON("PENDING", 0),
+				Polls: test.polls,
+			}
+
+			gce, stop := newFakeGCEProvider(fake, time.Second)
+			defer stop()
+
+			err := gce.CreateInstance(testInstanceSpec("client-00001", "client", false, true))
+
+			if test.class == "" && err != nil {
+				t.Fatalf("expected success, got: %v", err)
+			}
+
+			if test.class != "" {
+
+				if err == nil {
+					t.Fatalf("expected %s error, got success", test.class)
+				}
+
+				if ClassOf(err) != test.class {
+					t.Errorf("expected %s error, got: %v", test.class, err)
+				}
+			}
+
+			if fake.Polled() != test.polled {
+				t.Errorf("expected %d polls of the operation, got %d", test.polled, fake.Polled())
+			}
+		})
+	}
+}
+
+func TestStartOperationClassifies(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		start fakeResponse
+		class ErrorClass
+	}{
+		{"quota exceeded", fakeResponse{http.StatusForbidden, apiErrorJSON(http.StatusForbidden, "quotaExceeded")}, ErrQuota},
+		{"rate limited", fakeResponse{http.StatusForbidden, apiErrorJSON(http.StatusForbidden, "rateLimitExceeded")}, ErrTransient},
+		{"too many requests", fakeResponse{http.StatusTooManyRequests, apiErrorJSON(http.StatusTooManyRequests, "unknown")}, ErrTransient},
+		{"backend error", fakeResponse{http.StatusServiceUnavailable, apiErrorJSON(http.StatusServiceUnavailable, "backendError")}, ErrTransient},
+		{"server error", fakeResponse{http.StatusInternalServerError, apiErrorJSON(http.StatusInternalServerError, "unknown")}, ErrTransient},
+		{"unparsable response", fakeResponse{http.StatusBadGateway, "<html>bad gateway</html>"}, ErrTransient},
+		{"invalid request", fakeResponse{http.StatusBadRequest, apiErrorJSON(http.StatusBadRequest, "invalid")}, ErrPermanent},
+		{"already exists", fakeResponse{http.StatusConflict, apiErrorJSON(http.StatusConflict, "alreadyExists")}, ErrExists},
+		{"no operation", fakeResponse{http.StatusOK, "{}"}, ErrPermanent},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			fake := &fakeGCE{Start: test.start}
+
+			gce, stop := newFakeGCEProvider(fake, time.Second)
+			defer stop()
+
+			err := gce.CreateInstance(testInstanceSpec("client-00001", "client", false, true))
+			if err == nil {
+				t.Fatalf("expected %s error, got success", test.class)
+			}
+
+			if ClassOf(err) != test.class {
+				t.Errorf("expected %s error, got: %v", test.class, err)
+			}
+
+			if fake.Polled() != 0 {
+				t.Errorf("expected no polls of a failed call, got %d", fake.Polled())
+			}
+		})
+	}
+}
+
+func TestStartOperationUnreachable(t *testing.T) {
+
+	gce, stop := newFakeGCEProvider(&fakeGCE{}, time.Second)
+	stop()
+
+	err := gce.CreateInstance(testInstanceSpec("client-00001", "client", false, true))
+	if ClassOf(err) != ErrTransient {
+		t.Errorf("expected transient error, got: %v", err)
+	}
+}
+
+func TestWaitOperationTimeout(t *testing.T) {
+
+	fake := &fakeGCE{
+		Start: operationJSON("PENDING", 0),
+		Polls: []fakeResponse{operationJSON("RUNNING", 0)},
+	}
+
+	gce, stop := newFakeGCEProvider(fake, (20 * time.Millisecond))
+	defer stop()
+
+	err := gce.CreateInstance(testInstanceSpec("client-00001", "client", false, true))
+	if err == nil {
+		t.Fatalf("expected timeout, got success")
+	}
+
+	if ClassOf(err) != ErrTransient || !strings.Contains(err.Error(), "not done after") {
+		t.Errorf("expected transient timeout error, got: %v", err)
+	}
+
+	if fake.Polled() == 0 {
+		t.Errorf("expected operation to be polled before timing out")
+	}
+}
+
+func TestWaitOperationRateLimited(t *testing.T) {
+
+	fake := &fakeGCE{
+		Start: operationJSON("PENDING", 0),
+		Polls: []fakeResponse{
+			operationJSON("RUNNING", 0),
+			operationJSON("RUNNING", 0),
+			operationJSON("DONE", 0),
+		},
+	}
+
+	gce, stop := newFakeGCEProvider(fake, time.Second)
+	defer stop()
+
+	// Allow one call every 20ms, after the
+	// burst the insert call itself takes.
+	gce.Limiter = NewTokenBucket(50, 1)
+	rl := &RateLimitedProvider{Provider: gce, Bucket: gce.Limiter}
+
+	start := time.Now()
+
+	err := rl.CreateInstance(testInstanceSpec("client-00001", "client", false, true))
+	if err != nil {
+		t.Fatalf("expected success, got: %v", err)
+	}
+
+	if took := time.Since(start); took < (50 * time.Millisecond) {
+		t.Errorf("expected three polls to wait for tokens, took only %v", took)
+	}
+}
+
+func TestDeleteInstanceNotFound(t *testing.T) {
+
+	tests := []struct {
+		name string
+		fake *fakeGCE
+	}{
+		{"call", &fakeGCE{
+			Start: fakeResponse{http.StatusNotFound, apiErrorJSON(http.StatusNotFound, "notFound")},
+		}},
+		{"operation", &fakeGCE{
+			Start: operationJSON("PENDING", 0),
+			Polls: []fakeResponse{operationJSON("DONE", http.StatusNotFound, "RESOURCE_NOT_FOUND")},
+		}},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			gce, stop := newFakeGCEProvider(test.fake, time.Second)
+			defer stop()
+
+			err := gce.DeleteInstance("europe-west1-b", "client-00001")
+			if ClassOf(err) != ErrNotFound {
+				t.Errorf("expected not-found error deleting unknown instance, got: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Scopes granted to the service account of
+// each instance created for an experiment.
+var gceServiceAccScopes = []string{
+	"https://www.googleapis.com/auth/compute",
+	"https://www.googleapis.com/auth/servicecontrol",
+	"https://www.googleapis.com/auth/service.management",
+	"https://www.googleapis.com/auth/logging.write",
+	"https://www.googleapis.com/auth/monitoring.write",
+	"https://www.googleapis.com/auth/trace.append",
+	"https://www.googleapis.com/auth/devstorage.full_control",
+}
+
+// Names of instances, label keys and label
+// values, and metadata keys as accepted by GCE.
+var (
+	gceNameRegexp        = regexp.MustCompile(`^[a-z]([-a-z0-9]{0,61}[a-z0-9])?$`)
+	gceLabelKeyRegexp    = regexp.MustCompile(`^[a-z][-_a-z0-9]{0,62}$`)
+	gceLabelValueRegexp  = regexp.MustCompile(`^[-_a-z0-9]{0,63}$`)
+	gceMetadataKeyRegexp = regexp.MustCompile(`^[-_a-zA-Z0-9]{1,128}$`)
+)
+
+// gceInsertRequest is the body of the API
+// call creating a GCE instance.
+type gceInsertRequest struct {
+	Kind                string                 `json:"kind"`
+	Name                string                 `json:"name"`
+	Zone                string                 `json:"zone"`
+	MinCPUPlatform      string                 `json:"minCpuPlatform"`
+	MachineType         string                 `json:"machineType"`
+	DisplayDevice       gceDisplayDevice       `json:"displayDevice"`
+	Metadata            gceMetadata            `json:"metadata"`
+	Tags                gceTags                `json:"tags"`
+	Disks               []*gceAttachedDisk     `json:"disks"`
+	CanIPForward        bool                   `json:"canIpForward"`
+	NetworkInterfaces   []*gceNetworkInterface `json:"networkInterfaces"`
+	Description         string                 `json:"description"`
+	Labels              map[string]string      `json:"labels"`
+	Scheduling          gceScheduling          `json:"scheduling"`
+	DeletionProtection  bool                   `json:"deletionProtection"`
+	ReservationAffinity gceReservationAffinity `json:"reservationAffinity"`
+	ServiceAccounts     []*gceServiceAccount   `json:"serviceAccounts"`
+}
+
+type gceDisplayDevice struct {
+	EnableDisplay bool `json:"enableDisplay"`
+}
+
+type gceMetadata struct {
+	Kind  string          `json:"kind"`
+	Items []*MetadataItem `json:"items"`
+}
+
+type gceTags struct {
+	Items []string `json:"items"`
+}
+
+type gceAttachedDisk struct {
+	Kind              string             `json:"kind"`
+	Type              string             `json:"type"`
+	Boot              bool               `json:"boot"`
+	Mode              string             `json:"mode"`
+	AutoDelete        bool               `json:"autoDelete"`
+	DeviceName        string             `json:"deviceName"`
+	InitializeParams  gceInitializeParms `json:"initializeParams"`
+	DiskEncryptionKey struct{}           `json:"diskEncryptionKey"`
+}
+
+type gceInitializeParms struct {
+	SourceImage string `json:"sourceImage"`
+	DiskType    string `json:"diskType"`
+	DiskSizeGb  string `json:"diskSizeGb"`
+}
+
+type gceNetworkInterface struct {
+	Kind          string             `json:"kind"`
+	Subnetwork    string             `json:"subnetwork"`
+	AccessConfigs []*gceAccessConfig `json:"accessConfigs,omitempty"`
+	AliasIPRanges []string           `json:"aliasIpRanges"`
+}
+
+type gceAccessConfig struct {
+	Kind        string `json:"kind"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	NetworkTier string `json:"networkTier"`
+}
+
+type gceScheduling struct {
+	Preemptible       bool     `json:"preemptible"`
+	OnHostMaintenance string   `json:"onHostMaintenance"`
+	AutomaticRestart  bool     `json:"automaticRestart"`
+	NodeAffinities    []string `json:"nodeAffinities"`
+}
+
+type gceReservationAffinity struct {
+	ConsumeReservationType string `json:"consumeReservationType"`
+}
+
+type gceServiceAccount struct {
+	Email  string   `json:"email"`
+	Scopes []string `json:"scopes"`
+}
+
+// InsertRequest builds the request body for creating
+// the instance described by supplied spec, including
+// the startup script in the instance's metadata.
+func (gce *GCEProvider) InsertRequest(spec *InstanceSpec) *gceInsertRequest {
+
+	worker := spec.Worker
+	zonePrefix := fmt.Sprintf("projects/%s/zones/%s", gce.Project, worker.Zone)
+
+	// Append the startup script to the metadata
+	// items handed to us by the operator.
+	items := make([]*MetadataItem, len(spec.Metadata), (len(spec.Metadata) + 1))
+	copy(items, spec.Metadata)
+	items = append(items, &MetadataItem{
+		Key:   "startup-script-url",
+		Value: fmt.Sprintf("gs://%s/startup.sh", gce.Bucket),
+	})
+
+	// The region is the zone without its suffix.
+	region := worker.Zone
+	sep := strings.LastIndex(worker.Zone, "-")
+	if sep != -1 {
+		region = worker.Zone[:sep]
+	}
+
+	netIf := &gceNetworkInterface{
+		Kind:          "compute#networkInterface",
+		Subnetwork:    fmt.Sprintf("projects/%s/regions/%s/subnetworks/default", gce.Project, region),
+		AliasIPRanges: []string{},
+	}
+
+	if spec.PubliclyReachable {
+
+		netIf.AccessConfigs = []*gceAccessConfig{{
+			Kind:        "compute#accessConfig",
+			Name:        "External NAT",
+			Type:        "ONE_TO_ONE_NAT",
+			NetworkTier: "PREMIUM",
+		}}
+	}
+
+	// Preemptible instances can neither be
+	// migrated nor restarted automatically.
+	onHostMaintenance := "MIGRATE"
+	if spec.Preemptible {
+		onHostMaintenance = "TERMINATE"
+	}
+
+	return &gceInsertRequest{
+		Kind:           "compute#instance",
+		Name:           spec.Name,
+		Zone:           zonePrefix,
+		MinCPUPlatform: worker.MinCPUPlatform,
+		MachineType:    fmt.Sprintf("%s/machineTypes/%s", zonePrefix, worker.MachineType),
+		Metadata: gceMetadata{
+			Kind:  "compute#metadata",
+			Items: items,
+		},
+		Tags: gceTags{
+			Items: []string{},
+		},
+		Disks: []*gceAttachedDisk{{
+			Kind:       "compute#attachedDisk",
+			Type:       "PERSISTENT",
+			Boot:       true,
+			Mode:       "READ_WRITE",
+			AutoDelete: true,
+			DeviceName: spec.Name,
+			InitializeParams: gceInitializeParms{
+				SourceImage: fmt.Sprintf("projects/%s/global/images/%s", gce.Project, worker.SourceImage),
+				DiskType:    fmt.Sprintf("%s/diskTypes/%s", zonePrefix, worker.DiskType),
+				DiskSizeGb:  worker.DiskSize,
+			},
+		}},
+		NetworkInterfaces: []*gceNetworkInterface{netIf},
+		Labels:            copyLabels(spec.Labels),
+		Scheduling: gceScheduling{
+			Preemptible:       spec.Preemptible,
+			OnHostMaintenance: onHostMaintenance,
+			AutomaticRestart:  false,
+			NodeAffinities:    []string{},
+		},
+		ReservationAffinity: gceReservationAffinity{
+			ConsumeReservationType: "NO_RESERVATION",
+		},
+		ServiceAccounts: []*gceServiceAccount{{
+			Email:  gce.ServiceAcc,
+			Scopes: gceServiceAccScopes,
+		}},
+	}
+}
+
+// Validate checks the request for values GCE
+// would reject before the request is sent.
+func (r *gceInsertRequest) Validate() error {
+
+	if !gceNameRegexp.MatchString(r.Name) {
+		return fmt.Errorf("invalid instance name '%s'", r.Name)
+	}
+
+	if strings.HasSuffix(r.Zone, "/") {
+		return fmt.Errorf("instance %s is missing a zone", r.Name)
+	}
+
+	if strings.HasSuffix(r.MachineType, "/") {
+		return fmt.Errorf("instance %s is missing a machine type", r.Name)
+	}
+
+	for i := range r.Disks {
+
+		if strings.HasSuffix(r.Disks[i].InitializeParams.SourceImage, "/") {
+			return fmt.Errorf("disk of instance %s is missing a source image", r.Name)
+		}
+
+		if strings.HasSuffix(r.Disks[i].InitializeParams.DiskType, "/") {
+			return fmt.Errorf("disk of instance %s is missing a disk type", r.Name)
+		}
+
+		size, err := strconv.ParseInt(r.Disks[i].InitializeParams.DiskSizeGb, 10, 64)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("disk of instance %s has invalid size '%s'", r.Name, r.Disks[i].InitializeParams.DiskSizeGb)
+		}
+	}
+
+	keys := make(map[string]bool)
+	for _, item := range r.Metadata.Items {
+
+		if !gceMetadataKeyRegexp.MatchString(item.Key) {
+			return fmt.Errorf("invalid metadata key '%s' for instance %s", item.Key, r.Name)
+		}
+
+		if keys[item.Key] {
+			return fmt.Errorf("duplicate metadata key '%s' for instance %s", item.Key, r.Name)
+		}
+		keys[item.Key] = true
+	}
+
+	for key, value := range r.Labels {
+
+		if !gceLabelKeyRegexp.MatchString(key) || !gceLabelValueRegexp.MatchString(value) {
+			return fmt.Errorf("invalid label '%s: %s' for instance %s", key, value, r.Name)
+		}
+	}
+
+	if len(r.ServiceAccounts) == 0 || r.ServiceAccounts[0].Email == "" {
+		return fmt.Errorf("instance %s is missing a service account", r.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "Rewrite the golden files in testdata with the current output.")
+
+// testGCEProvider returns a GCE provider
+// for a fixed project, account, and bucket.
+func testGCEProvider() *GCEProvider {
+
+	return &GCEProvider{
+		Project:    "acs-eval",
+		ServiceAcc: "acs-eval@acs-eval.iam.gserviceaccount.com",
+		Bucket:     "acs-eval",
+	}
+}
+
+// testInstanceSpec returns the spec of an instance
+// for supplied worker as the operator creates it.
+func testInstanceSpec(name string, typeOfNode string, publiclyReachable bool, preemptible bool) *InstanceSpec {
+
+	worker := &Worker{
+		Name:           name,
+		Zone:           "europe-west1-b",
+		MinCPUPlatform: "Intel Skylake",
+		MachineType:    "n1-standard-4",
+		TypeOfNode:     typeOfNode,
+		SourceImage:    "acs",
+		DiskType:       "pd-ssd",
+		DiskSize:       "10",
+		Preemptible:    preemptible,
+	}
+
+	return &InstanceSpec{
+		Name:              worker.InstanceName(),
+		Worker:            worker,
+		PubliclyReachable: publiclyReachable,
+		Preemptible:       preemptible,
+		Labels: map[string]string{
+			ExpLabel: "0123456789abcdef",
+		},
+		Metadata: []*MetadataItem{
+			{Key: "expID", Value: "0123456789abcdef"},
+			{Key: "nameOfNode", Value: name},
+			{Key: "typeOfNode", Value: typeOfNode},
+			{Key: "workerToken", Value: "token"},
+		},
+	}
+}
+
+func TestInsertRequestGolden(t *testing.T) {
+
+	tests := []struct {
+		golden string
+		spec   *InstanceSpec
+	}{
+		{"insert-public-server.json", testInstanceSpec("server-00001", "server", true, false)},
+		{"insert-private-server.json", testInstanceSpec("server-00002", "server", false, false)},
+		{"insert-preemptible-client.json", testInstanceSpec("client-00001", "client", false, true)},
+	}
+
+	gce := testGCEProvider()
+
+	for _, test := range tests {
+
+		t.Run(test.golden, func(t *testing.T) {
+
+			insertReq := gce.InsertRequest(test.spec)
+
+			err := insertReq.Validate()
+			if err != nil {
+				t.Fatalf("valid request rejected: %v", err)
+			}
+
+			got, err := json.MarshalIndent(insertReq, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			path := filepath.Join("testdata", test.golden)
+
+			if *updateGolden {
+
+				err = ioutil.WriteFile(path, got, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Errorf("request differs from %s (run with -update to accept):\n%s", path, got)
+			}
+		})
+	}
+}
+
+func TestInsertRequestValidateRejects(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		modify func(*InstanceSpec, *GCEProvider)
+		errMsg string
+	}{
+		{"invalid name", func(spec *InstanceSpec, gce *GCEProvider) {
+			spec.Name = "Server_00001"
+		}, "invalid instance name"},
+		{"name too long", func(spec *InstanceSpec, gce *GCEProvider) {
+			spec.Name = strings.Repeat("a", 64)
+		}, "invalid instance name"},
+		{"missing zone", func(spec *InstanceSpec, gce *GCEProvider) {
+			spec.Worker.Zone = ""
+		}, "missing a zone"},
+		{"missing machine type", func(spec *InstanceSpec, gce *GCEProvider) {
+			spec.Worker.MachineType = ""
+		}, "missing a machine type"},
+		{"missing source image", func(spec *InstanceSpec, gce *GCEProvider) {
+			spec.Worker.SourceImage = ""
+		}, "missing a source image"},
+		{"missing disk type", func(spec *InstanceSpec, gce *GCEProvider) {
+			spec.Worker.DiskType = ""
+		}, "missing a disk type"},
+		{"invalid disk size", func(spec *InstanceSpec, gce *GCEProvider) {
+			spec.Worker.DiskSize = "10GB"
+		}, "invalid size"},
+		{"zero disk size", func(spec *InstanceSpec, gce *GCEProvider) {
+			spec.Worker.DiskSize = "0"
+		}, "invalid size"},
+		{"invalid metadata key", func(spec *InstanceSpec, gce *GCEProvider) {
+			spec.Metadata = append(spec.Metadata, &MetadataItem{Key: "worker token", Value: "x"})
+		}, "invalid metadata key"},
+		{"duplicate metadata key", func(spec *InstanceSpec, gce *GCEProvider) {
+			spec.Metadata = append(spec.Metadata, &MetadataItem{Key: "startup-script-url", Value: "x"})
+		}, "duplicate metadata key"},
+		{"invalid label", func(spec *InstanceSpec, gce *GCEProvider) {
+			spec.Labels[ExpLabel] = "Upper"
+		}, "invalid label"},
+		{"missing service account", func(spec *InstanceSpec, gce *GCEProvider) {
+			gce.ServiceAcc = ""
+		}, "missing a service account"},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			gce := testGCEProvider()
+			spec := testInstanceSpec("client-00001", "client", false, true)
+			test.modify(spec, gce)
+
+			err := gce.InsertRequest(spec).Validate()
+			if err == nil {
+				t.Fatalf("invalid request accepted")
+			}
+
+			if !strings.Contains(err.Error(), test.errMsg) {
+				t.Errorf("expected error containing '%s', got: %v", test.errMsg, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// LocalProvider runs every worker as a process of
+// the startup script on the operator's machine.
+// Optionally, each worker is isolated in its own
+// network namespace that is connected to the host
+// via a veth pair. Otherwise, all workers share the
+// host's network stack, each listening on its own
+// loopback address, and leave it untouched. A
+// metadata server stands in for the one of GCE so
+// that the startup script finds all values it expects.
+type LocalProvider struct {
+	sync.Mutex
+	StartupScript string
+	BaseDir       string
+	BucketDir     string
+	SkelDir       string
+	CertPath      string
+	MetadataPort  int
+	UseNetNS      bool
+	Instances     map[string]*localInstance
+	Creating      map[string]int
+}
+
+// localInstance tracks the process and, if
+// enabled, the network namespace of one
+// locally running worker.
+type localInstance struct {
+	Instance
+	Metadata    map[string]string
+	Subnet      int
+	IP          string
+	HostIP      string
+	NetNS       string
+	RootDir     string
+	MetadataSrv *http.Server
+	Cmd         *exec.Cmd
+	Done        chan struct{}
+}
+
+// NewLocalProvider prepares a local compute
+// provider keeping all worker folders and the
+// stand-in storage bucket under baseDir. Setting
+// up network namespaces requires root privileges.
+// Without them, the metadata of all workers is
+// served on the loopback interface right away.
+func NewLocalProvider(startupScript string, baseDir string, skelDir string, certPath string, metadataPort int, useNetNS bool) (*LocalProvider, error) {
+
+	if useNetNS && (os.Geteuid() != 0) {
+		return nil, fmt.Errorf("running workers in network namespaces requires root privileges")
+	}
+
+	startupScript, err := filepath.Abs(startupScript)
+	if err != nil {
+		return nil, err
+	}
+
+	baseDir, err = filepath.Abs(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	lp := &LocalProvider{
+		StartupScript: startupScript,
+		BaseDir:       baseDir,
+		BucketDir:     filepath.Join(baseDir, "bucket"),
+		SkelDir:       skelDir,
+		CertPath:      certPath,
+		MetadataPort:  metadataPort,
+		UseNetNS:      useNetNS,
+		Instances:     make(map[string]*localInstance),
+		Creating:      make(map[string]int),
+	}
+
+	err = os.MkdirAll(lp.BucketDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	if !lp.UseNetNS {
+
+		_, err = lp.ServeMetadata("127.0.0.1")
+		if err != nil {
+			return nil, err
+		}
+
+		return lp, nil
+	}
+
+	// Workers in different namespaces
+	// reach each other via the host.
+	err = runCmd("sysctl", "-w", "net.ipv4.ip_forward=1")
+	if err != nil {
+		return nil, err
+	}
+
+	return lp, nil
+}
+
+// runCmd executes a command and includes its
+// output in the returned error on failure.
+func runCmd(name string, args ...string) error {
+
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("'%s %s' failed (error: '%v'): %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// HandleMetadata answers requests of startup scripts
+// for their instance's metadata the same way the GCE
+// metadata server does. Paths are prefixed with the
+// name of the requesting instance. Workers in network
+// namespaces only get the metadata of their own
+// instance, as it contains the worker's token.
+func (lp *LocalProvider) HandleMetadata(w http.ResponseWriter, req *http.Request) {
+
+	if req.Header.Get("Metadata-Flavor") != "Google" {
+		http.Error(w, "Missing Metadata-Flavor header.", http.StatusForbidden)
+		return
+	}
+
+	// Split off name of instance from path.
+	pathParts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+	if len(pathParts) != 2 {
+		http.NotFound(w, req)
+		return
+	}
+
+	lp.Lock()
+	inst, found := lp.Instances[pathParts[0]]
+	lp.Unlock()
+
+	if !found {
+		http.NotFound(w, req)
+		return
+	}
+
+	if lp.UseNetNS {
+
+		remoteIP, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil || remoteIP != inst.IP {
+			http.Error(w, "Metadata of other instances is off limits.", http.StatusForbidden)
+			return
+		}
+	}
+
+	path := strings.TrimPrefix(pathParts[1], "computeMetadata/v1/instance/")
+
+	if path == "network-interfaces/0/ip" {
+		fmt.Fprint(w, inst.IP)
+	} else if path == "disks/0/type" {
+		fmt.Fprint(w, "local")
+	} else if strings.HasPrefix(path, "attributes/") {
+
+		value, found := inst.Metadata[strings.TrimPrefix(path, "attributes/")]
+		if !found {
+			http.NotFound(w, req)
+			return
+		}
+
+		fmt.Fprint(w, value)
+
+	} else {
+		http.NotFound(w, req)
+	}
+}
+
+// ServeMetadata serves the metadata of local instances
+// in background on supplied IP. Workers in network
+// namespaces reach it via the host side of their veth
+// pair, each on its own, all other workers share the
+// one on the loopback interface.
+func (lp *LocalProvider) ServeMetadata(ip string) (*http.Server, error) {
+
+	lisAddr := fmt.Sprintf("%s:%d", ip, lp.MetadataPort)
+
+	lis, err := net.Listen("tcp", lisAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed listening for metadata requests on %s: %v", lisAddr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", lp.HandleMetadata)
+
+	srv := &http.Server{Handler: mux}
+
+	fmt.Printf("[LOCAL] Serving instance metadata on http://%s...\n", lisAddr)
+
+	go func() {
+
+		err := srv.Serve(lis)
+		if err != nil && err != http.ErrServerClosed {
+			fmt.Printf("[LOCAL] Failed serving instance metadata on %s: %v\n", lisAddr, err)
+		}
+	}()
+
+	return srv, nil
+}
+
+// freeSubnet returns the lowest subnet index not used
+// by any instance, including the ones being created.
+// Caller has to hold the lock.
+func (lp *LocalProvider) freeSubnet() (int, error) {
+
+	for subnet := 1; subnet < 255; subnet++ {
+
+		used := false
+		for name := range lp.Instances {
+
+			if lp.Instances[name].Subnet == subnet {
+				used = true
+				break
+			}
+		}
+
+		for name := range lp.Creating {
+
+			if lp.Creating[name] == subnet {
+				used = true
+				break
+			}
+		}
+
+		if !used {
+			return subnet, nil
+		}
+	}
+
+	return 0, fmt.Errorf("all local subnets in use")
+}
+
+// setupNetNS creates the named network namespace of
+// an instance and connects it to the host via a veth
+// pair with addresses from the instance's subnet.
+func (inst *localInstance) setupNetNS(netNS string) error {
+
+	inst.NetNS = netNS
+
+	vethHost := fmt.Sprintf("acs%dh", inst.Subnet)
+	vethNS := fmt.Sprintf("acs%dn", inst.Subnet)
+
+	cmds := [][]string{
+		{"ip", "netns", "add", inst.NetNS},
+		{"ip", "link", "add", vethHost, "type", "veth", "peer", "name", vethNS},
+		{"ip", "link", "set", vethNS, "netns", inst.NetNS},
+		{"ip", "addr", "add", fmt.Sprintf("%s/24", inst.HostIP), "dev", vethHost},
+		{"ip", "link", "set", vethHost, "up"},
+		{"ip", "netns", "exec", inst.NetNS, "ip", "addr", "add", fmt.Sprintf("%s/24", inst.IP), "dev", vethNS},
+		{"ip", "netns", "exec", inst.NetNS, "ip", "link", "set", vethNS, "up"},
+		{"ip", "netns", "exec", inst.NetNS, "ip", "link", "set", "lo", "up"},
+		{"ip", "netns", "exec", inst.NetNS, "ip", "route", "add", "default", "via", inst.HostIP},
+	}
+
+	for i := range cmds {
+
+		err := runCmd(cmds[i][0], cmds[i][1:]...)
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateInstance prepares the folder and, if enabled,
+// the network namespace of a worker and launches the
+// startup script for it in background. The lock is
+// only held to reserve name and subnet, so that
+// instances are prepared in parallel.
+func (lp *LocalProvider) CreateInstance(spec *InstanceSpec) error {
+
+	worker := spec.Worker
+
+	lp.Lock()
+
+	_, found := lp.Instances[spec.Name]
+	_, creating := lp.Creating[spec.Name]
+	if found || creating {
+		lp.Unlock()
+		return &ProviderError{
+			Class: ErrExists,
+			Err:   fmt.Errorf("instance %s already exists", spec.Name),
+		}
+	}
+
+	subnet, err := lp.freeSubnet()
+	if err != nil {
+		lp.Unlock()
+		return err
+	}
+	lp.Creating[spec.Name] = subnet
+
+	lp.Unlock()
+
+	inst := &localInstance{
+		Instance: Instance{
+			Name:    spec.Name,
+			Zone:    worker.Zone,
+			Status:  "PROVISIONING",
+			Labels:  copyLabels(spec.Labels),
+			Created: time.Now(),
+		},
+		Metadata: make(map[string]string),
+		Subnet:   subnet,
+		IP:       fmt.Sprintf("127.0.%d.2", subnet),
+		HostIP:   "127.0.0.1",
+		RootDir:  filepath.Join(lp.BaseDir, spec.Name),
+		Done:     make(chan struct{}),
+	}
+
+	for i := range spec.Metadata {
+		inst.Metadata[spec.Metadata[i].Key] = spec.Metadata[i].Value
+	}
+
+	// Release everything acquired for the instance
+	// unless its startup script was launched.
+	launched := false
+	defer func() {
+
+		if launched {
+			return
+		}
+
+		if inst.MetadataSrv != nil {
+			_ = inst.MetadataSrv.Close()
+		}
+
+		// Deleting the namespace also removes both
+		// veth ends, unless the pair was not moved
+		// into the namespace yet.
+		if inst.NetNS != "" {
+			_ = runCmd("ip", "netns", "del", inst.NetNS)
+			_ = runCmd("ip", "link", "del", fmt.Sprintf("acs%dh", inst.Subnet))
+		}
+
+		lp.Lock()
+		delete(lp.Creating, spec.Name)
+		lp.Unlock()
+	}()
+
+	// Prepare folder standing in for the
+	// worker's file system, populated from
+	// the skeleton folder if one is set.
+	err = os.MkdirAll(inst.RootDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	if lp.SkelDir != "" {
+
+		err = runCmd("cp", "-a", fmt.Sprintf("%s/.", lp.SkelDir), inst.RootDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = runCmd("cp", lp.CertPath, filepath.Join(inst.RootDir, "operator-cert.pem"))
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("bash", lp.StartupScript)
+	cmd.Env = append(os.Environ(), "ACS_EVAL_SHARED_NET=1")
+
+	if lp.UseNetNS {
+
+		inst.HostIP = fmt.Sprintf("10.77.%d.1", inst.Subnet)
+		inst.IP = fmt.Sprintf("10.77.%d.2", inst.Subnet)
+
+		err = inst.setupNetNS(fmt.Sprintf("acs-%s", spec.Name))
+		if err != nil {
+			return err
+		}
+
+		// Only this worker can reach the metadata
+		// server on the host's veth end.
+		inst.MetadataSrv, err = lp.ServeMetadata(inst.HostIP)
+		if err != nil {
+			return err
+		}
+
+		// The operator is reachable from within
+		// the namespace via the host's veth end.
+		inst.Metadata["operatorIP"] = inst.HostIP
+
+		cmd = exec.Command("ip", "netns", "exec", inst.NetNS, "bash", lp.StartupScript)
+		cmd.Env = os.Environ()
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(inst.RootDir, "startup.log"), (os.O_WRONLY | os.O_CREATE | os.O_TRUNC | os.O_APPEND), 0644)
+	if err != nil {
+		return err
+	}
+
+	cmd.Dir = inst.RootDir
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Env = append(cmd.Env,
+		fmt.Sprintf("METADATA_URL=http://%s:%d/%s/computeMetadata/v1/instance", inst.HostIP, lp.MetadataPort, spec.Name),
+		fmt.Sprintf("ACS_EVAL_ROOT_DIR=%s", inst.RootDir),
+		fmt.Sprintf("ACS_EVAL_PIPE_DIR=%s", inst.RootDir),
+		fmt.Sprintf("ACS_EVAL_BUCKET_DIR=%s", lp.BucketDir),
+		"ACS_EVAL_LOCAL=1")
+
+	// Make metadata available before the
+	// startup script asks for it.
+	lp.Lock()
+	delete(lp.Creating, spec.Name)
+	lp.Instances[spec.Name] = inst
+	lp.Unlock()
+
+	err = cmd.Start()
+	if err != nil {
+
+		// Keep the subnet reserved until
+		// its veth pair is removed.
+		lp.Lock()
+		delete(lp.Instances, spec.Name)
+		lp.Creating[spec.Name] = inst.Subnet
+		lp.Unlock()
+
+		logFile.Close()
+
+		return err
+	}
+
+	launched = true
+
+	lp.Lock()
+	inst.Cmd = cmd
+	inst.Status = "RUNNING"
+	lp.Unlock()
+
+	// Mark instance as terminated once
+	// its startup script exits.
+	go func() {
+
+		_ = cmd.Wait()
+		logFile.Close()
+
+		lp.Lock()
+		inst.Status = "TERMINATED"
+		lp.Unlock()
+
+		close(inst.Done)
+	}()
+
+	return nil
+}
+
+// DeleteInstance kills all processes of a worker
+// and removes its network namespace, if any. The
+// worker's folder is kept for inspection.
+func (lp *LocalProvider) DeleteInstance(zone string, name string) error {
+
+	lp.Lock()
+	inst, found := lp.Instances[name]
+	_, creating := lp.Creating[name]
+	var cmd *exec.Cmd
+	if found {
+		cmd = inst.Cmd
+	}
+	lp.Unlock()
+
+	if creating || (found && (cmd == nil)) {
+		return &ProviderError{
+			Class: ErrTransient,
+			Err:   fmt.Errorf("instance %s is still being created", name),
+		}
+	}
+
+	if !found {
+		return &ProviderError{
+			Class: ErrNotFound,
+			Err:   fmt.Errorf("instance %s does not exist", name),
+		}
+	}
+
+	if inst.Zone != zone {
+		return &ProviderError{
+			Class: ErrPermanent,
+			Err:   fmt.Errorf("instance %s is in zone %s, not in %s", name, inst.Zone, zone),
+		}
+	}
+
+	// Kill the whole process group of the
+	// startup script and wait for it to exit.
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	<-inst.Done
+
+	if lp.UseNetNS {
+
+		_ = inst.MetadataSrv.Close()
+
+		err := runCmd("ip", "netns", "del", inst.NetNS)
+		if err != nil {
+			return err
+		}
+	}
+
+	lp.Lock()
+	delete(lp.Instances, name)
+	lp.Unlock()
+
+	return nil
+}
+
+// DescribeInstance returns the current
+// state of a local instance.
+func (lp *LocalProvider) DescribeInstance(zone string, name string) (*Instance, error) {
+
+	lp.Lock()
+	defer lp.Unlock()
+
+	inst, found := lp.Instances[name]
+	if !found || (inst.Zone != zone) {
+		return nil, fmt.Errorf("instance %s in zone %s does not exist", name, zone)
+	}
+
+	instCopy := inst.Instance
+
+	return &instCopy, nil
+}
+
+// ListInstances returns the current state
+// of all local instances.
+func (lp *LocalProvider) ListInstances() ([]*Instance, error) {
+
+	lp.Lock()
+	defer lp.Unlock()
+
+	instances := make([]*Instance, 0, len(lp.Instances))
+	for name := range lp.Instances {
+		instCopy := lp.Instances[name].Instance
+		instances = append(instances, &instCopy)
+	}
+
+	return instances, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MemProvider keeps all instances in memory
+// only. It does not boot anything, which makes
+// it useful for driving the orchestration logic
+// by hand via the internal API without any
+// cloud account involved. The metadata of each
+// instance, including the worker's token, stays
+// in memory as well and is optionally written to
+// a file per instance in MetadataDir.
+type MemProvider struct {
+	sync.Mutex
+	Instances      map[string]*Instance
+	Metadata       map[string]map[string]string
+	MetadataDir    string
+	ExhaustedZones map[string]bool
+	PreemptAfter   time.Duration
+}
+
+// NewMemProvider returns an empty in-memory compute
+// provider. Creating instances in any of the supplied
+// exhausted zones fails with a quota error. If set,
+// preemptible instances are terminated after preemptAfter.
+func NewMemProvider(exhaustedZones []string, preemptAfter time.Duration, metadataDir string) *MemProvider {
+
+	mem := &MemProvider{
+		Instances:      make(map[string]*Instance),
+		Metadata:       make(map[string]map[string]string),
+		MetadataDir:    metadataDir,
+		ExhaustedZones: make(map[string]bool),
+		PreemptAfter:   preemptAfter,
+	}
+
+	for i := range exhaustedZones {
+		mem.ExhaustedZones[exhaustedZones[i]] = true
+	}
+
+	return mem
+}
+
+// CreateInstance records a new running instance.
+func (mem *MemProvider) CreateInstance(spec *InstanceSpec) error {
+
+	mem.Lock()
+	defer mem.Unlock()
+
+	_, found := mem.Instances[spec.Name]
+	if found {
+		return &ProviderError{
+			Class: ErrExists,
+			Err:   fmt.Errorf("instance %s already exists", spec.Name),
+		}
+	}
+
+	if mem.ExhaustedZones[spec.Worker.Zone] {
+		return &ProviderError{
+			Class: ErrQuota,
+			Err:   fmt.Errorf("zone %s has no capacity left", spec.Worker.Zone),
+		}
+	}
+
+	metadata := make(map[string]string)
+	for i := range spec.Metadata {
+		metadata[spec.Metadata[i].Key] = spec.Metadata[i].Value
+	}
+
+	// Whoever drives the internal API by hand
+	// reads the worker's token from the file
+	// standing in for the metadata server.
+	if mem.MetadataDir != "" {
+
+		metadataJSON, err := json.MarshalIndent(metadata, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(filepath.Join(mem.MetadataDir, fmt.Sprintf("%s.json", spec.Name)), metadataJSON, 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	inst := &Instance{
+		Name:    spec.Name,
+		Zone:    spec.Worker.Zone,
+		Status:  "RUNNING",
+		Labels:  copyLabels(spec.Labels),
+		Created: time.Now(),
+	}
+	mem.Instances[spec.Name] = inst
+	mem.Metadata[spec.Name] = metadata
+
+	// Mimic GCE reclaiming the instance.
+	if spec.Preemptible && (mem.PreemptAfter > 0) {
+
+		time.AfterFunc(mem.PreemptAfter, func() {
+
+			mem.Lock()
+			defer mem.Unlock()
+
+			if mem.Instances[spec.Name] == inst {
+				inst.Status = "TERMINATED"
+				fmt.Printf("[MEM] Preempted instance %s.\n", spec.Name)
+			}
+		})
+	}
+
+	fmt.Printf("[MEM] Created instance %s.\n", spec.Name)
+
+	return nil
+}
+
+// MetadataOf returns the value of the metadata
+// item with supplied key of the named instance.
+func (mem *MemProvider) MetadataOf(name string, key string) string {
+
+	mem.Lock()
+	defer mem.Unlock()
+
+	return mem.Metadata[name][key]
+}
+
+// DeleteInstance forgets about an instance.
+func (mem *MemProvider) DeleteInstance(zone string, name string) error {
+
+	mem.Lock()
+	defer mem.Unlock()
+
+	inst, found := mem.Instances[name]
+	if !found {
+		return &ProviderError{
+			Class: ErrNotFound,
+			Err:   fmt.Errorf("instance %s does not exist", name),
+		}
+	}
+
+	if inst.Zone != zone {
+		return &ProviderError{
+			Class: ErrPermanent,
+			Err:   fmt.Errorf("instance %s is in zone %s, not in %s", name, inst.Zone, zone),
+		}
+	}
+
+	delete(mem.Instances, name)
+	delete(mem.Metadata, name)
+
+	return nil
+}
+
+// DescribeInstance returns a copy of the
+// recorded state of an instance.
+func (mem *MemProvider) DescribeInstance(zone string, name string) (*Instance, error) {
+
+	mem.Lock()
+	defer mem.Unlock()
+
+	inst, found := mem.Instances[name]
+	if !found || (inst.Zone != zone) {
+		return nil, fmt.Errorf("instance %s in zone %s does not exist", name, zone)
+	}
+
+	instCopy := *inst
+
+	return &instCopy, nil
+}
+
+// ListInstances returns copies of all
+// currently recorded instances.
+func (mem *MemProvider) ListInstances() ([]*Instance, error) {
+
+	mem.Lock()
+	defer mem.Unlock()
+
+	instances := make([]*Instance, 0, len(mem.Instances))
+	for name := range mem.Instances {
+		instCopy := *mem.Instances[name]
+		instances = append(instances, &instCopy)
+	}
+
+	return instances, nil
+}
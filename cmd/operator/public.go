@@ -4,6 +4,8 @@ import (
 	"crypto/rand"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/emicklei/go-restful"
@@ -13,50 +15,154 @@ import (
 // public endpoint of the operator and specifies the
 // execution details of one experiment in full.
 type ExpReq struct {
-	System       string    `json:"system"`
-	ResultFolder string    `json:"resultFolder"`
-	Servers      []*Worker `json:"servers"`
-	Clients      []*Worker `json:"clients"`
+	System             string    `json:"system"`
+	ResultFolder       string    `json:"resultFolder"`
+	ClientsPerMachine  int       `json:"clientsPerMachine"`
+	Pairing            string    `json:"pairing"`
+	PairingSeed        int64     `json:"pairingSeed"`
+	ExpectedDuration   string    `json:"expectedDuration"`
+	TeardownPolicy     string    `json:"teardownPolicy"`
+	ClientTolerance    string    `json:"clientTolerance"`
+	PreemptibleClients bool      `json:"preemptibleClients"`
+	Priority           int       `json:"priority"`
+	Servers            []*Worker `json:"servers"`
+	Clients            []*Worker `json:"clients"`
 }
 
-// PublicAuth augments all routes by requiring an
-// Authorization header in order for continuation.
-func (op *Operator) PublicAuth(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+// ExpFromReq validates an experiment request and
+// assembles the experiment it describes, including
+// the pairing of its clients. Only the fields that
+// depend on the submission itself are left unset.
+func ExpFromReq(expReq *ExpReq) (*Exp, error) {
 
-	authHeader := req.HeaderParameter("Authorization")
+	// Experiments not specifying how many logical
+	// clients to run per machine get the default.
+	if expReq.ClientsPerMachine == 0 {
+		expReq.ClientsPerMachine = DefaultClientsPerMachine
+	}
 
-	// Expect correct (static) password.
-	if authHeader != "UniverseOfLoopholes" {
-		resp.WriteError(http.StatusUnauthorized, nil)
-		return
+	if expReq.ClientsPerMachine < 0 || expReq.ClientsPerMachine > MaxClientsPerMachine {
+		return nil, fmt.Errorf("clients per machine need to be between 1 and %d", MaxClientsPerMachine)
+	}
+
+	// Every logical client converses with exactly
+	// one partner, their total needs to be even.
+	if ((expReq.ClientsPerMachine * len(expReq.Clients)) % 2) != 0 {
+		return nil, fmt.Errorf("%d clients per machine on %d machines leave one client without partner",
+			expReq.ClientsPerMachine, len(expReq.Clients))
+	}
+
+	if expReq.Pairing == "" {
+		expReq.Pairing = string(PairSameMachine)
+	}
+
+	if !ValidPairing(PairingStrategy(expReq.Pairing)) {
+		return nil, fmt.Errorf("unknown pairing strategy '%s'", expReq.Pairing)
+	}
+
+	// Without a fixed seed, draw one and record
+	// it so the pairing can be reproduced.
+	if expReq.PairingSeed == 0 {
+		expReq.PairingSeed = time.Now().UnixNano()
+	}
+
+	teardown, err := ParseTeardownPolicy(expReq.TeardownPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	tolerance, err := ParseFailureTolerance(expReq.ClientTolerance)
+	if err != nil {
+		return nil, err
+	}
+
+	exp := &Exp{
+		System:             expReq.System,
+		Priority:           expReq.Priority,
+		ResultFolder:       expReq.ResultFolder,
+		ClientsPerMachine:  expReq.ClientsPerMachine,
+		Pairing:            PairingStrategy(expReq.Pairing),
+		PairingSeed:        expReq.PairingSeed,
+		TeardownPolicy:     teardown.String(),
+		ClientTolerance:    tolerance.String(),
+		PreemptibleClients: expReq.PreemptibleClients,
+		Progress:           make([]string, 0, 50),
+		Servers:            make([]*Worker, len(expReq.Servers)),
+		ServersMap:         make(map[string]*Worker),
+		Clients:            make([]*Worker, len(expReq.Clients)),
+		ClientsMap:         make(map[string]*Worker),
+	}
+
+	for i := range expReq.Servers {
+		expReq.Servers[i].Status = WorkerPending
+		expReq.Servers[i].Transitions = nil
+		expReq.Servers[i].Preemptible = false
+		exp.Servers[i] = expReq.Servers[i]
+		exp.ServersMap[expReq.Servers[i].Name] = expReq.Servers[i]
 	}
 
-	// Possibly move to next filter.
-	chain.ProcessFilter(req, resp)
+	for i := range expReq.Clients {
+		expReq.Clients[i].Status = WorkerPending
+		expReq.Clients[i].Transitions = nil
+		expReq.Clients[i].Preemptible = expReq.PreemptibleClients
+		exp.Clients[i] = expReq.Clients[i]
+		exp.ClientsMap[expReq.Clients[i].Name] = expReq.Clients[i]
+	}
+
+	exp.Pairs, err = PairClients(exp.Clients, exp.ClientsPerMachine, exp.Pairing, exp.PairingSeed)
+	if err != nil {
+		return nil, fmt.Errorf("pairing clients failed: %v", err)
+	}
+	exp.indexPairs()
+
+	return exp, nil
 }
 
-// HandlerPutNew creates a new experiment, if possible.
-func (op *Operator) HandlerPutNew(req *restful.Request, resp *restful.Response) {
+// EstimateCost returns what running the instances of
+// supplied experiment costs for the duration it is
+// expected to take. Without a pricing table, there
+// is no estimate.
+func (op *Operator) EstimateCost(exp *Exp, expectedDuration string) (*CostEstimate, error) {
 
-	fmt.Printf("[PUT /experiments/new] Handling new request from %s.\n", req.Request.RemoteAddr)
+	if op.Pricing == nil {
+		return nil, nil
+	}
 
-	op.Lock()
-	inProg := op.ExpInProgress
-	op.Unlock()
+	duration := op.ExpectedDuration
+	if expectedDuration != "" {
 
-	// If an experiment is already running,
-	// no further one is allowed to run.
-	if inProg != "" {
-		resp.WriteErrorString(http.StatusConflict, "An experiment is already being conducted at the moment.")
-		return
+		var err error
+		duration, err = time.ParseDuration(expectedDuration)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid expected duration '%s'", expectedDuration)
+		}
 	}
 
+	workers := make([]*Worker, 0, (len(exp.Servers) + len(exp.Clients)))
+	workers = append(workers, exp.Servers...)
+	workers = append(workers, exp.Clients...)
+
+	cost, err := op.Pricing.Estimate(workers, duration)
+	if err != nil {
+		return nil, fmt.Errorf("estimating cost failed: %v", err)
+	}
+	cost.Budget = op.Budget
+	cost.OverBudget = (op.Budget > 0) && (cost.PerRun > op.Budget)
+
+	return cost, nil
+}
+
+// HandlerPutNew creates a new experiment and
+// appends it to the queue of experiments.
+func (op *Operator) HandlerPutNew(req *restful.Request, resp *restful.Response) {
+
+	fmt.Printf("[PUT /experiments/new] Handling new request from %s.\n", req.Request.RemoteAddr)
+
 	accessToken := req.HeaderParameter("AccessToken")
 	if accessToken != "" {
-		op.GCloudAccessToken = accessToken
+		op.SetAccessToken(accessToken)
 	}
 
-	exp := &Exp{}
 	expReq := &ExpReq{}
 
 	// Extract experiment details from request.
@@ -66,6 +172,51 @@ func (op *Operator) HandlerPutNew(req *restful.Request, resp *restful.Response)
 		return
 	}
 
+	// Experiments not specifying a teardown
+	// policy get the operator's default.
+	if expReq.TeardownPolicy == "" {
+		expReq.TeardownPolicy = op.TeardownPolicy
+	}
+
+	exp, err := ExpFromReq(expReq)
+	if err != nil {
+		resp.WriteErrorString(http.StatusBadRequest, fmt.Sprintf("Invalid experiment: %v.", err))
+		return
+	}
+
+	// Estimate what running the experiment costs.
+	cost, err := op.EstimateCost(exp, expReq.ExpectedDuration)
+	if err != nil {
+		resp.WriteErrorString(http.StatusBadRequest, fmt.Sprintf("Invalid experiment: %v.", err))
+		return
+	}
+
+	// Dry runs only report the cost estimate,
+	// flagged if it exceeds the budget.
+	if req.QueryParameter("dryRun") == "true" {
+
+		if cost == nil {
+			resp.WriteErrorString(http.StatusBadRequest, "Operator has no pricing table to estimate cost with.")
+			return
+		}
+
+		fmt.Printf("[PUT /experiments/new] Returning cost estimate of dry run to %s.\n", req.Request.RemoteAddr)
+
+		resp.WriteHeaderAndEntity(http.StatusOK, cost)
+		return
+	}
+
+	// Turn down experiments exceeding the budget.
+	if (cost != nil) && cost.OverBudget {
+
+		op.Audit.Record(principal(req), "reject", "", req.Request.RemoteAddr,
+			fmt.Sprintf("estimated cost %.2f %s exceeds budget %.2f", cost.PerRun, cost.Currency, op.Budget))
+
+		resp.WriteErrorString(http.StatusBadRequest, fmt.Sprintf("Estimated cost of %.2f %s (%.2f per hour for %.1f hours) exceeds budget of %.2f %s.",
+			cost.PerRun, cost.Currency, cost.PerHour, cost.Hours, op.Budget, cost.Currency))
+		return
+	}
+
 	// Generate new random id.
 	id := make([]byte, 8)
 	_, err = rand.Read(id)
@@ -74,47 +225,83 @@ func (op *Operator) HandlerPutNew(req *restful.Request, resp *restful.Response)
 		return
 	}
 
-	// Fill in complete experiment specification.
+	// Fill in the details of this submission.
 	exp.ID = fmt.Sprintf("%x", id)
 	exp.Created = time.Now().Format("2006-02-03_15:04:05")
-	exp.System = expReq.System
-	exp.Concluded = false
-	exp.ResultFolder = expReq.ResultFolder
-	exp.Progress = make([]string, 0, 50)
-	exp.ProgressChan = make(chan string)
-	exp.Servers = make([]*Worker, len(expReq.Servers))
-	exp.ServersMap = make(map[string]*Worker)
-	exp.Clients = make([]*Worker, len(expReq.Clients))
-	exp.ClientsMap = make(map[string]*Worker)
-
-	exp.RegisterChan = make(chan *RegisterReq)
-	exp.ReadyChan = make(chan string)
-	exp.FinishedChan = make(chan string)
-	exp.FailedChan = make(chan *FailedReq)
-	exp.TerminateChan = make(chan struct{})
+	exp.SubmittedBy = principal(req)
+	exp.State = ExpQueued
+	exp.Transitions = []*Transition{{To: string(ExpQueued), At: time.Now()}}
+	exp.Queued = true
+	exp.QueuedAt = time.Now().UnixNano()
+	exp.Cost = cost
+	exp.prepareChans()
+
+	// Add experiment to map of all experiments
+	// and persist it before it is started.
+	op.Lock()
+	op.Exps[exp.ID] = exp
+	op.Unlock()
 
-	for i := range expReq.Servers {
-		exp.Servers[i] = expReq.Servers[i]
-		exp.ServersMap[expReq.Servers[i].Name] = expReq.Servers[i]
-	}
+	op.persistExp(exp)
 
-	for i := range expReq.Clients {
-		exp.Clients[i] = expReq.Clients[i]
-		exp.ClientsMap[expReq.Clients[i].Name] = expReq.Clients[i]
-	}
+	// Hand experiment to the queue the goroutine
+	// conducting the experiments pulls from. From
+	// now on, it may start any moment, thus only
+	// touch the snapshot taken right here.
+	op.Lock()
+	exp.QueuePosition = op.Queue.Push(exp.ID, exp.Priority, exp.QueuedAt)
+	queued := exp.snapshot()
+	queued.QueuePosition = exp.QueuePosition
+	op.Unlock()
 
-	// Add experiment to map of all experiments.
-	op.Exps[exp.ID] = exp
+	op.Audit.Record(queued.SubmittedBy, "submit", queued.ID, req.Request.RemoteAddr,
+		fmt.Sprintf("system '%s', priority %d, %d servers, %d clients", queued.System, queued.Priority, len(queued.Servers), len(queued.Clients)))
 
-	// Signal goroutine conducting the
-	// experiments availability of the new one.
-	op.PublicNewChan <- exp.ID
+	fmt.Printf("[PUT /experiments/new] Successfully queued new experiment %s from %s (%s) at position %d.\n",
+		queued.ID, queued.SubmittedBy, req.Request.RemoteAddr, queued.QueuePosition)
 
-	fmt.Printf("[PUT /experiments/new] Successfully added new experiment %s from %s.\n", exp.ID, req.Request.RemoteAddr)
+	op.notify(exp, EventQueued, "", "")
 
 	// Send experiment information up to this
 	// point back to client.
-	resp.WriteHeaderAndEntity(http.StatusCreated, exp)
+	resp.WriteHeaderAndEntity(http.StatusCreated, queued)
+}
+
+// HandlerPutPlan returns the fully resolved plan
+// of the experiment in the request without
+// submitting the experiment or touching the cloud.
+func (op *Operator) HandlerPutPlan(req *restful.Request, resp *restful.Response) {
+
+	fmt.Printf("[PUT /experiments/plan] Handling new request from %s.\n", req.Request.RemoteAddr)
+
+	expReq := &ExpReq{}
+
+	// Extract experiment details from request.
+	err := req.ReadEntity(expReq)
+	if err != nil {
+		resp.WriteError(http.StatusInternalServerError, nil)
+		return
+	}
+
+	// Experiments not specifying a teardown
+	// policy get the operator's default.
+	if expReq.TeardownPolicy == "" {
+		expReq.TeardownPolicy = op.TeardownPolicy
+	}
+
+	exp, err := ExpFromReq(expReq)
+	if err != nil {
+		resp.WriteErrorString(http.StatusBadRequest, fmt.Sprintf("Invalid experiment: %v.", err))
+		return
+	}
+
+	plan, err := op.PlanExp(exp, expReq.ExpectedDuration)
+	if err != nil {
+		resp.WriteErrorString(http.StatusBadRequest, fmt.Sprintf("Invalid experiment: %v.", err))
+		return
+	}
+
+	resp.WriteHeaderAndEntity(http.StatusOK, plan)
 }
 
 // HandlerGetExpStatus returns the
@@ -125,14 +312,121 @@ func (op *Operator) HandlerGetExpStatus(req *restful.Request, resp *restful.Resp
 
 	fmt.Printf("[GET /experiments/%s/status] Returning experiment status to %s.\n", expID, req.Request.RemoteAddr)
 
-	// If experiment exists, return its status.
+	// If experiment exists, take a snapshot of its
+	// status, which is written without any lock held.
+	op.Lock()
 	exp, found := op.Exps[expID]
 	if !found {
+		op.Unlock()
 		resp.WriteErrorString(http.StatusInternalServerError, fmt.Sprintf("Experiment %s does not exist.", expID))
 		return
 	}
 
-	resp.WriteHeaderAndEntity(http.StatusOK, exp)
+	status := exp.snapshot()
+	if exp.State == ExpQueued {
+		status.QueuePosition = op.Queue.Position(expID)
+	}
+	op.Unlock()
+
+	status.Progress, _ = exp.ProgressSince(0)
+
+	resp.WriteHeaderAndEntity(http.StatusOK, status)
+}
+
+// HandlerGetQueue returns all experiments waiting
+// to be conducted in the order they will be run.
+func (op *Operator) HandlerGetQueue(req *restful.Request, resp *restful.Response) {
+
+	fmt.Printf("[GET /experiments/queue] Returning experiment queue to %s.\n", req.Request.RemoteAddr)
+
+	resp.WriteHeaderAndEntity(http.StatusOK, op.Queue.List())
+}
+
+// HandlerGetExpProgressStream pushes each progress line
+// of an experiment as a server-sent event. Clients resume
+// after the line they saw last via the Last-Event-ID header
+// or the 'offset' query parameter. The stream ends with an
+// 'end' event once no further lines will be appended.
+func (op *Operator) HandlerGetExpProgressStream(req *restful.Request, resp *restful.Response) {
+
+	expID := req.PathParameter("expID")
+
+	op.Lock()
+	exp, found := op.Exps[expID]
+	op.Unlock()
+
+	if !found {
+		resp.WriteErrorString(http.StatusNotFound, fmt.Sprintf("Experiment %s does not exist.", expID))
+		return
+	}
+
+	offsetParam := req.QueryParameter("offset")
+	if req.HeaderParameter("Last-Event-ID") != "" {
+		offsetParam = req.HeaderParameter("Last-Event-ID")
+	}
+
+	offset := 0
+	if offsetParam != "" {
+
+		var err error
+		offset, err = strconv.Atoi(offsetParam)
+		if err != nil || offset < 0 {
+			resp.WriteErrorString(http.StatusBadRequest, fmt.Sprintf("Invalid progress offset '%s'.", offsetParam))
+			return
+		}
+	}
+
+	flusher, ok := resp.ResponseWriter.(http.Flusher)
+	if !ok {
+		resp.WriteErrorString(http.StatusInternalServerError, "Streaming not supported.")
+		return
+	}
+
+	fmt.Printf("[GET /experiments/%s/progress/stream] Streaming progress from line %d to %s.\n", expID, offset, req.Request.RemoteAddr)
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Keep intermediaries from closing
+	// the connection during quiet phases.
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+
+		lines, wake := exp.ProgressSince(offset)
+
+		for i := range lines {
+
+			// The ID of each event is the offset
+			// to resume the stream at after it.
+			offset++
+
+			fmt.Fprintf(resp.ResponseWriter, "id: %d\nevent: progress\n", offset)
+			for _, dataLine := range strings.Split(lines[i], "\n") {
+				fmt.Fprintf(resp.ResponseWriter, "data: %s\n", dataLine)
+			}
+			fmt.Fprintf(resp.ResponseWriter, "\n")
+		}
+		flusher.Flush()
+
+		if wake == nil {
+			fmt.Fprintf(resp.ResponseWriter, "event: end\ndata: %s\n\n", expID)
+			flusher.Flush()
+			return
+		}
+
+		select {
+		case <-wake:
+		case <-keepAlive.C:
+			fmt.Fprintf(resp.ResponseWriter, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-req.Request.Context().Done():
+			return
+		}
+	}
 }
 
 // HandlerGetExpTerminate terminates an
@@ -146,18 +440,59 @@ func (op *Operator) HandlerGetExpTerminate(req *restful.Request, resp *restful.R
 
 	accessToken := req.HeaderParameter("AccessToken")
 	if accessToken != "" {
-		op.GCloudAccessToken = accessToken
+		op.SetAccessToken(accessToken)
 	}
 
-	// If experiment exists, signal to terminate it.
-	_, found := op.Exps[expID]
+	op.Lock()
+	exp, found := op.Exps[expID]
+	op.Unlock()
+
 	if found {
-		op.Exps[expID].TerminateChan <- struct{}{}
+		op.Audit.Record(principal(req), "terminate", expID, req.Request.RemoteAddr, "")
+	}
+
+	if found && op.Queue.Remove(expID) {
+
+		// Experiments still waiting in the queue
+		// have no instances yet, simply conclude.
+		op.Lock()
+		exp.QueuePosition = 0
+		op.Unlock()
+
+		_ = op.EnterExpState(exp, ExpConcluded, "terminated while queued")
+		exp.EndProgress()
+
+	} else if found && exp.State == ExpRecovered {
+
+		// Experiments recovered after an operator
+		// restart are not conducted by anyone,
+		// tear them down here.
+		go op.TeardownRecovered(exp, "termination request")
+
+	} else if found {
+
+		// Signal to terminate experiment.
+		op.SignalTerminate(exp, "")
 	}
 
 	resp.WriteHeader(http.StatusOK)
 }
 
+// HandlerGetOrphans reports all instances the
+// reaper would delete, without deleting them.
+func (op *Operator) HandlerGetOrphans(req *restful.Request, resp *restful.Response) {
+
+	fmt.Printf("[GET /instances/orphaned] Returning orphaned instances to %s.\n", req.Request.RemoteAddr)
+
+	orphans, err := op.FindOrphans()
+	if err != nil {
+		resp.WriteErrorString(http.StatusInternalServerError, fmt.Sprintf("Failed listing instances: %v", err))
+		return
+	}
+
+	resp.WriteHeaderAndEntity(http.StatusOK, orphans)
+}
+
 // PreparePublicSrv initializes all API-related
 // things in order to expose an Internet-facing
 // API endpoint for conducting experiments.
@@ -170,16 +505,41 @@ func (op *Operator) PreparePublicSrv() {
 		Produces(restful.MIME_JSON)
 
 	op.PublicSrv.Route(op.PublicSrv.PUT("/new").
-		Filter(op.PublicAuth).
+		Filter(op.PublicAuth("submit")).
 		To(op.HandlerPutNew))
 
+	op.PublicSrv.Route(op.PublicSrv.PUT("/plan").
+		Filter(op.PublicAuth("submit")).
+		To(op.HandlerPutPlan))
+
+	op.PublicSrv.Route(op.PublicSrv.GET("/queue").
+		Filter(op.PublicAuth("view")).
+		To(op.HandlerGetQueue))
+
 	op.PublicSrv.Route(op.PublicSrv.GET("/{expID}/status").
-		Filter(op.PublicAuth).
+		Filter(op.PublicAuth("view")).
 		To(op.HandlerGetExpStatus))
 
+	op.PublicSrv.Route(op.PublicSrv.GET("/{expID}/progress/stream").
+		Filter(op.PublicAuth("view")).
+		Produces("text/event-stream").
+		To(op.HandlerGetExpProgressStream))
+
 	op.PublicSrv.Route(op.PublicSrv.GET("/{expID}/terminate").
-		Filter(op.PublicAuth).
+		Filter(op.PublicAuth("terminate")).
 		To(op.HandlerGetExpTerminate))
 
 	restful.Add(op.PublicSrv)
+
+	instancesSrv := new(restful.WebService)
+
+	instancesSrv.Path("/public/instances").
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON)
+
+	instancesSrv.Route(instancesSrv.GET("/orphaned").
+		Filter(op.PublicAuth("view")).
+		To(op.HandlerGetOrphans))
+
+	restful.Add(instancesSrv)
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// QueueEntry is one experiment waiting
+// in the queue to be conducted.
+type QueueEntry struct {
+	ExpID    string `json:"id"`
+	Priority int    `json:"priority"`
+	QueuedAt int64  `json:"queuedAt"`
+	Position int    `json:"position"`
+}
+
+// ExpQueue holds all experiments waiting to be
+// conducted. Experiments with higher priority are
+// served first, those with equal priority in the
+// order they were submitted in.
+type ExpQueue struct {
+	sync.Mutex
+	cond    *sync.Cond
+	entries []*QueueEntry
+}
+
+// NewExpQueue returns an empty experiment queue.
+func NewExpQueue() *ExpQueue {
+
+	q := &ExpQueue{
+		entries: make([]*QueueEntry, 0, 20),
+	}
+	q.cond = sync.NewCond(q)
+
+	return q
+}
+
+// before reports whether entry a is
+// to be served before entry b.
+func (a *QueueEntry) before(b *QueueEntry) bool {
+
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+
+	return a.QueuedAt < b.QueuedAt
+}
+
+// Push enqueues an experiment and returns its
+// resulting one-based position in the queue.
+func (q *ExpQueue) Push(expID string, priority int, queuedAt int64) int {
+
+	q.Lock()
+	defer q.Unlock()
+
+	entry := &QueueEntry{
+		ExpID:    expID,
+		Priority: priority,
+		QueuedAt: queuedAt,
+	}
+
+	// Find index of first entry that is
+	// served after the new one.
+	idx := sort.Search(len(q.entries), func(i int) bool {
+		return entry.before(q.entries[i])
+	})
+
+	q.entries = append(q.entries, nil)
+	copy(q.entries[(idx+1):], q.entries[idx:])
+	q.entries[idx] = entry
+
+	// Wake up a waiting consumer.
+	q.cond.Signal()
+
+	return idx + 1
+}
+
+// Pop blocks until an experiment is queued and
+// returns the ID of the one to be served next.
+func (q *ExpQueue) Pop() string {
+
+	q.Lock()
+	defer q.Unlock()
+
+	for len(q.entries) == 0 {
+		q.cond.Wait()
+	}
+
+	entry := q.entries[0]
+	q.entries = q.entries[1:]
+
+	return entry.ExpID
+}
+
+// Remove takes an experiment out of the queue
+// and reports whether it was queued at all.
+func (q *ExpQueue) Remove(expID string) bool {
+
+	q.Lock()
+	defer q.Unlock()
+
+	for i := range q.entries {
+
+		if q.entries[i].ExpID == expID {
+			q.entries = append(q.entries[:i], q.entries[(i+1):]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Position returns the current one-based position
+// of an experiment in the queue, or zero if it is
+// not queued.
+func (q *ExpQueue) Position(expID string) int {
+
+	q.Lock()
+	defer q.Unlock()
+
+	for i := range q.entries {
+
+		if q.entries[i].ExpID == expID {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// List returns copies of all queued entries
+// in the order they will be served in.
+func (q *ExpQueue) List() []*QueueEntry {
+
+	q.Lock()
+	defer q.Unlock()
+
+	entries := make([]*QueueEntry, len(q.entries))
+	for i := range q.entries {
+		entryCopy := *q.entries[i]
+		entryCopy.Position = i + 1
+		entries[i] = &entryCopy
+	}
+
+	return entries
+}
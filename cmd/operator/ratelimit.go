@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket limits the rate of calls to the
+// configured number per second, while allowing
+// bursts of up to the configured size.
+type TokenBucket struct {
+	sync.Mutex
+	Rate   float64
+	Burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// RateLimitedProvider passes all calls on to the
+// wrapped provider after taking a token from the
+// bucket shared by all of them.
+type RateLimitedProvider struct {
+	Provider Provider
+	Bucket   *TokenBucket
+}
+
+// NewTokenBucket returns a full bucket
+// with supplied rate and burst size.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+
+	return &TokenBucket{
+		Rate:   rate,
+		Burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available and
+// takes it. Callers that find the bucket empty
+// reserve a future token and sleep until then,
+// thus they are served in the order they arrived.
+func (tb *TokenBucket) Wait() {
+
+	tb.Lock()
+
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.Rate
+	if tb.tokens > tb.Burst {
+		tb.tokens = tb.Burst
+	}
+	tb.last = now
+
+	tb.tokens--
+
+	var wait time.Duration
+	if tb.tokens < 0 {
+		wait = time.Duration((-tb.tokens / tb.Rate) * float64(time.Second))
+	}
+
+	tb.Unlock()
+
+	time.Sleep(wait)
+}
+
+// CreateInstance waits for a token and creates the instance.
+func (rl *RateLimitedProvider) CreateInstance(spec *InstanceSpec) error {
+
+	rl.Bucket.Wait()
+
+	return rl.Provider.CreateInstance(spec)
+}
+
+// DeleteInstance waits for a token and deletes the instance.
+func (rl *RateLimitedProvider) DeleteInstance(zone string, name string) error {
+
+	rl.Bucket.Wait()
+
+	return rl.Provider.DeleteInstance(zone, name)
+}
+
+// DescribeInstance waits for a token and describes the instance.
+func (rl *RateLimitedProvider) DescribeInstance(zone string, name string) (*Instance, error) {
+
+	rl.Bucket.Wait()
+
+	return rl.Provider.DescribeInstance(zone, name)
+}
+
+// ListInstances waits for a token and lists all instances.
+func (rl *RateLimitedProvider) ListInstances() ([]*Instance, error) {
+
+	rl.Bucket.Wait()
+
+	return rl.Provider.ListInstances()
+}
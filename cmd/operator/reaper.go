@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// ExpLabel is the label every instance created
+// by the operator carries, set to the ID of the
+// experiment the instance belongs to.
+const ExpLabel = "acs-exp"
+
+// Orphan is an instance the reaper deletes,
+// together with the reason for deleting it.
+type Orphan struct {
+	Name    string    `json:"name"`
+	Zone    string    `json:"zone"`
+	ExpID   string    `json:"expID"`
+	Created time.Time `json:"created"`
+	Reason  string    `json:"reason"`
+}
+
+// FindOrphans lists all instances created by the operator
+// and returns those whose experiment concluded, whose
+// experiment is unknown, or that were replaced by a
+// respawned instance. Instances without the experiment
+// label are left alone.
+func (op *Operator) FindOrphans() ([]*Orphan, error) {
+
+	instances, err := op.Provider.ListInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	orphans, _ := op.findOrphans(instances)
+
+	return orphans, nil
+}
+
+// findOrphans returns the orphans among supplied instances
+// and all experiments still in flight that own an instance
+// which outlived the instance TTL. Those experiments are
+// not orphans, the runner has to end them.
+func (op *Operator) findOrphans(instances []*Instance) ([]*Orphan, []*Exp) {
+
+	orphans := make([]*Orphan, 0, len(instances))
+	expired := make([]*Exp, 0)
+	seen := make(map[string]bool)
+
+	op.Lock()
+	defer op.Unlock()
+
+	for _, inst := range instances {
+
+		expID, labeled := inst.Labels[ExpLabel]
+		if !labeled {
+			continue
+		}
+
+		reason := ""
+		exp, found := op.Exps[expID]
+
+		if !found {
+			reason = "experiment unknown"
+		} else if exp.Concluded {
+			reason = "experiment concluded"
+		} else if _, current := exp.workerByInstance(inst.Name); !current {
+			reason = "replaced by respawned instance"
+		} else if (op.InstanceTTL > 0) && (time.Since(inst.Created) > op.InstanceTTL) && !seen[expID] {
+			seen[expID] = true
+			expired = append(expired, exp)
+		}
+
+		if reason == "" {
+			continue
+		}
+
+		orphans = append(orphans, &Orphan{
+			Name:    inst.Name,
+			Zone:    inst.Zone,
+			ExpID:   expID,
+			Created: inst.Created,
+			Reason:  reason,
+		})
+	}
+
+	return orphans, expired
+}
+
+// expire fails an experiment whose instances outlived
+// the instance TTL and has it torn down the same way
+// a termination request would.
+func (op *Operator) expire(exp *Exp) {
+
+	reason := fmt.Sprintf("instances older than %s", op.InstanceTTL)
+
+	op.Lock()
+	state := exp.State
+	if exp.FailureReason == "" {
+		exp.FailureReason = reason
+	}
+	op.Unlock()
+
+	// Experiments being torn down
+	// end on their own shortly.
+	if state == ExpTearingDown {
+		return
+	}
+
+	fmt.Printf("[REAPER] Terminating experiment %s in state '%s': %s.\n", exp.ID, state, reason)
+
+	op.persistExp(exp)
+
+	if state == ExpRecovered {
+		go op.TeardownRecovered(exp, "instance TTL expiry")
+		return
+	}
+
+	op.SignalTerminate(exp, "instance TTL expiry")
+}
+
+// Reap deletes all orphaned instances and records
+// the deletion with the worker, if its experiment
+// is known. Experiments whose instances outlived the
+// instance TTL are terminated. It returns how many
+// deletions failed.
+func (op *Operator) Reap() int {
+
+	instances, err := op.Provider.ListInstances()
+	if err != nil {
+		fmt.Printf("[REAPER] Failed listing instances: %v\n", err)
+		return 0
+	}
+
+	orphans, expired := op.findOrphans(instances)
+
+	for _, exp := range expired {
+		op.expire(exp)
+	}
+
+	failed := 0
+
+	for _, orphan := range orphans {
+
+		fmt.Printf("[REAPER] Deleting instance %s in %s of experiment %s (%s).\n",
+			orphan.Name, orphan.Zone, orphan.ExpID, orphan.Reason)
+
+		err := op.deleteInstance(orphan.Zone, orphan.Name)
+		if err != nil {
+			fmt.Printf("[REAPER] Failed deleting instance %s: %v\n", orphan.Name, err)
+			failed++
+			continue
+		}
+
+		op.Lock()
+		exp, found := op.Exps[orphan.ExpID]
+		var worker *Worker
+		if found {
+			worker, found = exp.workerByInstance(orphan.Name)
+			if found {
+				worker.Spawned = false
+			}
+		}
+		op.Unlock()
+
+		if found {
+			op.persistWorker(exp, worker)
+		}
+	}
+
+	return failed
+}
+
+// RunReaper periodically deletes all orphaned
+// instances until the operator stops.
+func (op *Operator) RunReaper(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		op.Reap()
+	}
+}
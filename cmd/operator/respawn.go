@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+)
+
+// InstanceName returns the name of the compute
+// instance currently backing the worker. Unless
+// the worker was respawned, it is the worker's.
+func (worker *Worker) InstanceName() string {
+
+	if worker.Instance != "" {
+		return worker.Instance
+	}
+
+	return worker.Name
+}
+
+// workerByInstance returns the server or client of
+// an experiment currently backed by named instance.
+func (exp *Exp) workerByInstance(instance string) (*Worker, bool) {
+
+	for _, workers := range [][]*Worker{exp.Servers, exp.Clients} {
+
+		for i := range workers {
+
+			if workers[i].InstanceName() == instance {
+				return workers[i], true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// mayRespawn reports whether a worker that failed, went
+// silent, or got preempted gets a replacement instance.
+// Only workers in one of the supplied states, all before
+// becoming ready, qualify, as long as they have attempts
+// left. Vuvuzela servers are fixed once their addresses
+// went into pki.conf.
+func (op *Operator) mayRespawn(exp *Exp, worker *Worker, states ...WorkerState) bool {
+
+	op.Lock()
+	defer op.Unlock()
+
+	if !worker.Status.in(states) || worker.Respawns >= op.RespawnAttempts {
+		return false
+	}
+
+	_, isServer := exp.ServersMap[worker.Name]
+	if isServer && exp.ServersFixed {
+		return false
+	}
+
+	return true
+}
+
+// Respawn marks a worker lost during initialization
+// as respawning and replaces its instance in the
+// background. Meanwhile, its phase cannot complete.
+func (op *Operator) Respawn(exp *Exp, worker *Worker, reason string) {
+
+	err := op.EnterWorkerState(exp, worker, WorkerRespawning, reason)
+	if err != nil {
+		exp.ProgressChan <- fmt.Sprintf("Cannot respawn %s: %v.", worker.Name, err)
+		return
+	}
+
+	exp.Spawns.Add(1)
+	go op.respawn(exp, worker)
+}
+
+// respawn deletes the lost instance of a worker and
+// spawns a replacement under a new instance name,
+// optionally in another zone of the same region. The
+// worker keeps its name, thus its logical clients and
+// partners stay the same. A replacement that cannot
+// be created fails the worker.
+func (op *Operator) respawn(exp *Exp, worker *Worker) {
+
+	defer exp.Spawns.Done()
+
+	// An instance that cannot be deleted
+	// now is left to the reaper.
+	_ = op.ShutdownInstance(exp, worker)
+
+	_, isServer := exp.ServersMap[worker.Name]
+
+	op.Lock()
+
+	worker.Respawns++
+	worker.Instance = fmt.Sprintf("%s-r%d", worker.Name, worker.Respawns)
+	worker.Address = ""
+
+	zone := worker.Zone
+	if op.RespawnOtherZone {
+
+		zones := fallbackZones(worker.Zone)
+		if len(zones) > 0 {
+			zone = zones[((worker.Respawns - 1) % len(zones))]
+		}
+	}
+
+	if zone != worker.Zone {
+		worker.Zone = zone
+		exp.relocate(worker.Name, zone)
+	}
+
+	// Callbacks of the replacement start from scratch
+	// and may arrive before its creation returned. The
+	// lost instance is locked out until SpawnInstance
+	// mints the replacement's token.
+	worker.Token = ""
+	worker.Reported = WorkerPending
+
+	op.Unlock()
+
+	_ = op.EnterWorkerState(exp, worker, WorkerPending, fmt.Sprintf("replaced by instance %s", worker.Instance))
+
+	exp.ProgressChan <- fmt.Sprintf("Respawning %s as instance %s in zone %s (attempt %d of %d).",
+		worker.Name, worker.Instance, worker.Zone, worker.Respawns, op.RespawnAttempts)
+
+	err := op.SpawnInstance(exp, worker, isServer)
+	if err != nil {
+		exp.report(&WorkerEvent{
+			Worker: worker.Name,
+			State:  WorkerFailed,
+			Reason: fmt.Sprintf("replacement instance creation failed: %v", err),
+		})
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
-	"net/http"
+	"math/rand"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -14,229 +15,46 @@ import (
 	"github.com/numbleroot/acs-test-bed/cmd/operator/zenopki"
 )
 
-var tmplInstanceCreate = `{
-	"kind": "compute#instance",
-	"name": "ACS_EVAL_INSERT_GCP_MACHINE_NAME",
-	"zone": "ACS_EVAL_INSERT_ZONE",
-	"minCpuPlatform": "ACS_EVAL_INSERT_MIN_CPU_PLATFORM",
-	"machineType": "ACS_EVAL_INSERT_MACHINE_TYPE",
-	"displayDevice": {
-		"enableDisplay": false
-	},
-	"metadata": {
-		"kind": "compute#metadata",
-		"items": [
-			{
-				"key": "operatorIP",
-				"value": "ACS_EVAL_INSERT_META_OPERATOR_IP"
-			},
-			{
-				"key": "expID",
-				"value": "ACS_EVAL_INSERT_META_EXP_ID"
-			},
-			{
-				"key": "nameOfNode",
-				"value": "ACS_EVAL_INSERT_META_NAME_OF_NODE"
-			},
-			{
-				"key": "evalSystem",
-				"value": "ACS_EVAL_INSERT_META_EVAL_SYSTEM"
-			},
-			{
-				"key": "numClients",
-				"value": "ACS_EVAL_INSERT_META_NUM_CLIENTS"
-			},
-			{
-				"key": "resultFolder",
-				"value": "ACS_EVAL_INSERT_META_RESULT_FOLDER"
-			},
-			{
-				"key": "typeOfNode",
-				"value": "ACS_EVAL_INSERT_META_TYPE_OF_NODE"
-			},
-			{
-				"key": "binaryToPull",
-				"value": "ACS_EVAL_INSERT_META_BINARY_TO_PULL"
-			},
-			{
-				"key": "pungServerIP",
-				"value": "ACS_EVAL_INSERT_META_PUNG_SERVER_IP"
-			},
-			{
-				"key": "tcConfig",
-				"value": "ACS_EVAL_INSERT_META_TC_CONFIG"
-			},
-			{
-				"key": "killZenoMixesInRound",
-				"value": "ACS_EVAL_INSERT_META_KILL_ZENO_MIXES_IN_ROUND"
-			},
-			{
-				"key": "client01",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_01_NAME"
-			},
-			{
-				"key": "partner01",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_01_PARTNER"
-			},
-			{
-				"key": "client02",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_02_NAME"
-			},
-			{
-				"key": "partner02",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_02_PARTNER"
-			},
-			{
-				"key": "client03",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_03_NAME"
-			},
-			{
-				"key": "partner03",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_03_PARTNER"
-			},
-			{
-				"key": "client04",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_04_NAME"
-			},
-			{
-				"key": "partner04",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_04_PARTNER"
-			},
-			{
-				"key": "client05",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_05_NAME"
-			},
-			{
-				"key": "partner05",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_05_PARTNER"
-			},
-			{
-				"key": "client06",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_06_NAME"
-			},
-			{
-				"key": "partner06",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_06_PARTNER"
-			},
-			{
-				"key": "client07",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_07_NAME"
-			},
-			{
-				"key": "partner07",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_07_PARTNER"
-			},
-			{
-				"key": "client08",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_08_NAME"
-			},
-			{
-				"key": "partner08",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_08_PARTNER"
-			},
-			{
-				"key": "client09",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_09_NAME"
-			},
-			{
-				"key": "partner09",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_09_PARTNER"
-			},
-			{
-				"key": "client10",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_10_NAME"
-			},
-			{
-				"key": "partner10",
-				"value": "ACS_EVAL_INSERT_META_CLIENT_10_PARTNER"
-			},
-			{
-				"key": "startup-script-url",
-				"value": "ACS_EVAL_INSERT_META_STARTUP_SCRIPT"
-			}
-		]
-	},
-	"tags": {
-		"items": []
-	},
-	"disks": [
-		{
-			"kind": "compute#attachedDisk",
-			"type": "PERSISTENT",
-			"boot": true,
-			"mode": "READ_WRITE",
-			"autoDelete": true,
-			"deviceName": "ACS_EVAL_INSERT_GCP_MACHINE_NAME",
-			"initializeParams": {
-				"sourceImage": "ACS_EVAL_INSERT_SOURCE_IMAGE",
-				"diskType": "ACS_EVAL_INSERT_DISK_TYPE",
-				"diskSizeGb": "ACS_EVAL_INSERT_DISK_SIZE"
-			},
-			"diskEncryptionKey": {}
-		}
-	],
-	"canIpForward": false,
-	"networkInterfaces": [
-		{
-			"kind": "compute#networkInterface",
-			"subnetwork": "ACS_EVAL_INSERT_SUBNETWORK",ACS_EVAL_INSERT_ACCESS_CONFIG
-			"aliasIpRanges": []
-		}
-	],
-	"description": "",
-	"labels": {},
-	"scheduling": {
-		"preemptible": false,
-		"onHostMaintenance": "MIGRATE",
-		"automaticRestart": false,
-		"nodeAffinities": []
-	},
-	"deletionProtection": false,
-	"reservationAffinity": {
-		"consumeReservationType": "NO_RESERVATION"
-	},
-	"serviceAccounts": [
-		{
-			"email": "ACS_EVAL_INSERT_SERVICE_ACCOUNT",
-			"scopes": [
-				"https://www.googleapis.com/auth/compute",
-				"https://www.googleapis.com/auth/servicecontrol",
-				"https://www.googleapis.com/auth/service.management",
-				"https://www.googleapis.com/auth/logging.write",
-				"https://www.googleapis.com/auth/monitoring.write",
-				"https://www.googleapis.com/auth/trace.append",
-				"https://www.googleapis.com/auth/devstorage.full_control"
-			]
-		}
-	]
-}`
-
-var tmplInstancePublicIP = `
-			"accessConfigs": [
-				{
-					"kind": "compute#accessConfig",
-					"name": "External NAT",
-					"type": "ONE_TO_ONE_NAT",
-					"networkTier": "PREMIUM"
-				}
-			],`
+// Number of logical clients run on each client
+// machine if an experiment does not specify it,
+// and the most that fit into the reserved ports.
+const (
+	DefaultClientsPerMachine = 10
+	MaxClientsPerMachine     = 99
+)
 
-// SpawnInstance provisions a compute instance with
-// the characteristics from supplied worker struct.
-func (op *Operator) SpawnInstance(exp *Exp, worker *Worker, publiclyReachable bool) {
+// Suffixes of the zones a GCloud region may consist
+// of, in the order zone fallback tries them.
+var zoneSuffixes = []string{"a", "b", "c", "d", "f"}
+
+// InstanceSpec assembles the provider-agnostic
+// description of the instance for supplied worker,
+// including all metadata used by the startup script.
+func (op *Operator) InstanceSpec(exp *Exp, worker *Worker, publiclyReachable bool) *InstanceSpec {
 
-	clientIDs := make(map[int]string)
+	// Experiments persisted before clients per
+	// machine were configurable ran ten of them.
+	perMachine := exp.ClientsPerMachine
+	if perMachine == 0 {
+		perMachine = DefaultClientsPerMachine
+	}
 
 	// Calculate start and end IDs for
 	// this client machine to handle.
-	lastClient := worker.ID * 10
-	firstClient := lastClient - 10
-	totalClients := len(exp.Clients) * 10
+	lastClient := worker.ID * perMachine
+	firstClient := lastClient - perMachine
+	totalClients := len(exp.Clients) * perMachine
+
+	var clientIDs []string
+	var partnerIDs []string
 
 	if worker.TypeOfNode == "client" {
 
-		for i := 1; i <= 10; i++ {
-			clientIDs[i] = fmt.Sprintf("client-%05d", (firstClient + i))
+		// Partners were assigned according to the
+		// experiment's pairing strategy on submission.
+		for i := (firstClient + 1); i <= lastClient; i++ {
+			clientIDs = append(clientIDs, fmt.Sprintf("client-%05d", i))
+			partnerIDs = append(partnerIDs, exp.partnerOf(i))
 		}
 
 	} else {
@@ -244,198 +62,675 @@ func (op *Operator) SpawnInstance(exp *Exp, worker *Worker, publiclyReachable bo
 		// In case of servers, only one
 		// logical node will be spawned,
 		// the server itself.
-		clientIDs[1] = worker.Name
+		clientIDs = []string{worker.Name}
+		partnerIDs = []string{"irrelevant"}
+	}
 
-		for i := 2; i <= 10; i++ {
-			clientIDs[i] = "irrelevant"
-		}
+	pungServerIP := "irrelevant"
+	if (exp.System == "pung") && (worker.TypeOfNode == "client") {
+		pungServerIP = strings.Split(exp.ServersMap["server-00001"].Address, ":")[0]
 	}
 
-	exp.ProgressChan <- fmt.Sprintf("Spawning %s.", worker.Name)
+	// Workers send heartbeats often enough
+	// for a few to get lost without harm.
+	heartbeatInterval := int((op.HeartbeatTimeout / 4).Seconds())
+	if heartbeatInterval < 1 {
+		heartbeatInterval = 30
+	}
 
-	// Customize API endpoint to send request to.
-	endpoint := fmt.Sprintf("https://www.googleapis.com/compute/v1/projects/%s/zones/%s/instances", op.GCloudProject, worker.Zone)
+	// Fill in the metadata values. These
+	// are used by the startup script.
+	metadata := []*MetadataItem{
+		{Key: "operatorIP", Value: strings.Split(op.InternalListenAddr, ":")[0]},
+		{Key: "expID", Value: exp.ID},
+		{Key: "nameOfNode", Value: worker.Name},
+		{Key: "evalSystem", Value: exp.System},
+		{Key: "numClients", Value: fmt.Sprintf("%d", totalClients)},
+		{Key: "clientsPerMachine", Value: fmt.Sprintf("%d", perMachine)},
+		{Key: "clients", Value: strings.Join(clientIDs, ",")},
+		{Key: "partners", Value: strings.Join(partnerIDs, ",")},
+		{Key: "resultFolder", Value: exp.ResultFolder},
+		{Key: "typeOfNode", Value: worker.TypeOfNode},
+		{Key: "binaryToPull", Value: worker.BinaryName},
+		{Key: "pungServerIP", Value: pungServerIP},
+		{Key: "tcConfig", Value: worker.NetTroubles},
+		{Key: "killZenoMixesInRound", Value: fmt.Sprintf("%d", worker.ZenoMixesKilled)},
+		{Key: "workerToken", Value: worker.Token},
+		{Key: "heartbeatInterval", Value: fmt.Sprintf("%d", heartbeatInterval)},
+	}
 
-	// Prepare request body.
+	return &InstanceSpec{
+		Name:              worker.InstanceName(),
+		Worker:            worker,
+		PubliclyReachable: publiclyReachable,
+		Preemptible:       worker.Preemptible,
+		Labels: map[string]string{
+			ExpLabel: exp.ID,
+		},
+		Metadata: metadata,
+	}
+}
 
-	reqBody := strings.ReplaceAll(tmplInstanceCreate, "ACS_EVAL_INSERT_GCP_MACHINE_NAME", worker.Name)
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_ZONE", fmt.Sprintf("projects/%s/zones/%s", op.GCloudProject, worker.Zone))
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_MIN_CPU_PLATFORM", worker.MinCPUPlatform)
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_MACHINE_TYPE", fmt.Sprintf("projects/%s/zones/%s/machineTypes/%s", op.GCloudProject,
-		worker.Zone, worker.MachineType))
+// SpawnInstance provisions a compute instance with
+// the characteristics from supplied worker struct.
+func (op *Operator) SpawnInstance(exp *Exp, worker *Worker, publiclyReachable bool) error {
 
-	// Replace placeholders in metadata.
-	// These are used by the startup script.
+	exp.ProgressChan <- fmt.Sprintf("Spawning %s.", worker.InstanceName())
 
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_OPERATOR_IP", strings.Split(op.InternalListenAddr, ":")[0])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_EXP_ID", exp.ID)
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_NAME_OF_NODE", worker.Name)
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_EVAL_SYSTEM", exp.System)
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_NUM_CLIENTS", fmt.Sprintf("%d", totalClients))
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_RESULT_FOLDER", exp.ResultFolder)
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_TYPE_OF_NODE", worker.TypeOfNode)
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_BINARY_TO_PULL", worker.BinaryName)
+	// Mint the secret this worker authenticates
+	// its calls to the internal API with.
+	token, err := NewWorkerToken()
+	if err != nil {
+		return fmt.Errorf("generating token for instance %s failed: %v", worker.InstanceName(), err)
+	}
 
-	if (exp.System == "pung") && (worker.TypeOfNode == "client") {
-		reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_PUNG_SERVER_IP", strings.Split(exp.ServersMap["server-00001"].Address, ":")[0])
-	} else {
-		reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_PUNG_SERVER_IP", "irrelevant")
-	}
-
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_TC_CONFIG", worker.NetTroubles)
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_KILL_ZENO_MIXES_IN_ROUND", fmt.Sprintf("%d", worker.ZenoMixesKilled))
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_01_NAME", clientIDs[1])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_01_PARTNER", clientIDs[2])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_02_NAME", clientIDs[2])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_02_PARTNER", clientIDs[1])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_03_NAME", clientIDs[3])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_03_PARTNER", clientIDs[4])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_04_NAME", clientIDs[4])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_04_PARTNER", clientIDs[3])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_05_NAME", clientIDs[5])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_05_PARTNER", clientIDs[6])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_06_NAME", clientIDs[6])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_06_PARTNER", clientIDs[5])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_07_NAME", clientIDs[7])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_07_PARTNER", clientIDs[8])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_08_NAME", clientIDs[8])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_08_PARTNER", clientIDs[7])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_09_NAME", clientIDs[9])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_09_PARTNER", clientIDs[10])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_10_NAME", clientIDs[10])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_CLIENT_10_PARTNER", clientIDs[9])
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_META_STARTUP_SCRIPT", fmt.Sprintf("gs://%s/startup.sh", op.GCloudBucket))
-
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_SOURCE_IMAGE", fmt.Sprintf("projects/%s/global/images/%s", op.GCloudProject,
-		worker.SourceImage))
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_DISK_TYPE", fmt.Sprintf("projects/%s/zones/%s/diskTypes/%s", op.GCloudProject,
-		worker.Zone, worker.DiskType))
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_DISK_SIZE", worker.DiskSize)
-
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_SUBNETWORK", fmt.Sprintf("projects/%s/regions/%s/subnetworks/default",
-		op.GCloudProject, strings.TrimSuffix(worker.Zone, "-b")))
-
-	if publiclyReachable {
-		reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_ACCESS_CONFIG", tmplInstancePublicIP)
-	} else {
-		reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_ACCESS_CONFIG", "")
+	// Record the instance as spawned before contacting
+	// the provider, so that after a crash the operator
+	// knows about all instances that might exist. A new
+	// token locks out the replaced instance of a worker.
+	op.Lock()
+	worker.Token = token
+	worker.Spawned = true
+	op.Unlock()
+
+	op.persistWorker(exp, worker)
+
+	// Instruct compute provider to create the instance.
+	start := time.Now()
+	err = op.createInstance(exp, worker, publiclyReachable)
+	spawnSeconds.Observe(time.Since(start).Seconds(), outcome(err))
+	if err != nil {
+		return fmt.Errorf("spawning instance %s failed: %v", worker.InstanceName(), err)
 	}
 
-	reqBody = strings.ReplaceAll(reqBody, "ACS_EVAL_INSERT_SERVICE_ACCOUNT", op.GCloudServiceAcc)
+	exp.ProgressChan <- fmt.Sprintf("Instance %s running, waiting for initialization to finish.", worker.InstanceName())
+
+	return nil
+}
 
-	// Create HTTP POST request.
-	request, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(reqBody))
+// ownsInstance reports whether the existing instance
+// of supplied worker was created for this experiment,
+// i.e., by an attempt that looked failed to us.
+func (op *Operator) ownsInstance(exp *Exp, worker *Worker) bool {
+
+	inst, err := op.Provider.DescribeInstance(worker.Zone, worker.InstanceName())
 	if err != nil {
-		exp.ProgressChan <- fmt.Sprintf("Failed creating HTTP API request to spawn %s: %v", worker.Name, err)
-		os.Exit(1)
+		return false
 	}
-	request.Header.Set(http.CanonicalHeaderKey("authorization"), fmt.Sprintf("Bearer %s", op.GCloudAccessToken))
-	request.Header.Set(http.CanonicalHeaderKey("content-type"), "application/json")
 
-	// Send the request to GCP.
-	tried := 0
-	resp, err := http.DefaultClient.Do(request)
-	for err != nil && tried < 10 {
+	return inst.Labels[ExpLabel] == exp.ID
+}
+
+// createInstance asks the compute provider to create
+// the instance of supplied worker. Transient failures
+// are retried with exponential backoff. An instance
+// found to exist already counts as created if it
+// carries the experiment's label. If zone fallback
+// is enabled, quota failures move the worker on to the
+// next zone of the same region that has not been tried.
+func (op *Operator) createInstance(exp *Exp, worker *Worker, publiclyReachable bool) error {
+
+	zones := fallbackZones(worker.Zone)
+	attempt := 0
+
+	for {
+
+		if exp.spawnsStopped() {
+			return fmt.Errorf("experiment %s ended", exp.ID)
+		}
+
+		err := op.Provider.CreateInstance(op.InstanceSpec(exp, worker, publiclyReachable))
+		if err == nil {
+			return nil
+		}
+
+		class := ClassOf(err)
+
+		if class == ErrExists && op.ownsInstance(exp, worker) {
+			return nil
+		}
 
-		tried++
-		exp.ProgressChan <- fmt.Sprintf("Create API request for %s failed (will try again): %v", worker.Name, err)
-		time.Sleep(1 * time.Second)
+		if class == ErrTransient && attempt < op.CreateRetries {
 
-		resp, err = http.DefaultClient.Do(request)
+			delay := op.backoff(attempt)
+			attempt++
+
+			exp.ProgressChan <- fmt.Sprintf("Creating instance %s failed (attempt %d, retrying in %s): %v",
+				worker.InstanceName(), attempt, delay.Round(time.Millisecond), err)
+			time.Sleep(delay)
+
+			continue
+		}
+
+		if class != ErrQuota || !op.ZoneFallback || len(zones) == 0 {
+			return err
+		}
+
+		exp.ProgressChan <- fmt.Sprintf("Zone %s cannot host instance %s (%v), falling back to zone %s.",
+			worker.Zone, worker.InstanceName(), err, zones[0])
+
+		// Move the worker and everyone
+		// paired with it to the new zone.
+		op.Lock()
+		worker.Zone = zones[0]
+		exp.relocate(worker.Name, zones[0])
+		op.Unlock()
+
+		op.persistWorker(exp, worker)
+		op.persistExp(exp)
+
+		zones = zones[1:]
+		attempt = 0
 	}
+}
 
-	if tried >= 10 {
-		exp.ProgressChan <- fmt.Sprintf("Create API request for %s failed permanently: %v", worker.Name, err)
-		os.Exit(1)
+// deleteInstance asks the compute provider to delete
+// the named instance in zone. Transient failures are
+// retried with exponential backoff, as many times as
+// creating an instance is. An instance the provider
+// does not know about counts as deleted.
+func (op *Operator) deleteInstance(zone string, name string) error {
+
+	attempt := 0
+
+	for {
+
+		err := op.Provider.DeleteInstance(zone, name)
+		if err == nil || ClassOf(err) == ErrNotFound {
+			return nil
+		}
+
+		if ClassOf(err) != ErrTransient || attempt >= op.CreateRetries {
+			return err
+		}
+
+		delay := op.backoff(attempt)
+		attempt++
+
+		fmt.Printf("[RUNNER] Deleting instance %s failed (attempt %d, retrying in %s): %v\n",
+			name, attempt, delay.Round(time.Millisecond), err)
+		time.Sleep(delay)
 	}
+}
 
-	// Read the response.
-	outRaw, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		exp.ProgressChan <- fmt.Sprintf("Failed reading from instance create response body for %s: %v", worker.Name, err)
-		os.Exit(1)
+// backoff returns how long to wait before retrying
+// after the numbered failed attempt. The delay doubles
+// with each attempt up to a cap, and a random half of
+// it is jittered away so that concurrently spawning
+// workers do not hit the provider in lockstep.
+func (op *Operator) backoff(attempt int) time.Duration {
+
+	delay := op.CreateBackoff
+	for i := 0; i < attempt && delay < op.CreateBackoffMax; i++ {
+		delay *= 2
 	}
-	defer resp.Body.Close()
 
-	out := string(outRaw)
+	if delay > op.CreateBackoffMax {
+		delay = op.CreateBackoffMax
+	}
 
-	// Verify successful machine creation.
-	if strings.Contains(out, "RUNNING") || strings.Contains(out, "DONE") {
-		exp.ProgressChan <- fmt.Sprintf("Instance %s running, waiting for initialization to finish.", worker.Name)
-	} else {
-		exp.ProgressChan <- fmt.Sprintf("Spawning instance %s returned failure message: '%s'", worker.Name, out)
-		os.Exit(1)
+	if delay < 2 {
+		return delay
+	}
+
+	return (delay / 2) + time.Duration(rand.Int63n(int64(delay/2)))
+}
+
+// fallbackZones returns all other zones of the
+// region the supplied zone belongs to.
+func fallbackZones(zone string) []string {
+
+	sep := strings.LastIndex(zone, "-")
+	if sep == -1 {
+		return nil
 	}
+
+	zones := make([]string, 0, len(zoneSuffixes))
+
+	for i := range zoneSuffixes {
+
+		candidate := fmt.Sprintf("%s-%s", zone[:sep], zoneSuffixes[i])
+		if candidate != zone {
+			zones = append(zones, candidate)
+		}
+	}
+
+	return zones
 }
 
-// ShutdownInstance instructs GCP to shut down and
-// subsequently delete an instance.
-func (op *Operator) ShutdownInstance(wg *sync.WaitGroup, exp *Exp, worker *Worker) {
+// ShutdownInstance instructs the compute provider to
+// shut down and subsequently delete an instance.
+func (op *Operator) ShutdownInstance(exp *Exp, worker *Worker) error {
 
-	defer wg.Done()
+	// Nothing to delete if the
+	// instance was never spawned.
+	if !worker.Spawned {
+		return nil
+	}
 
-	exp.ProgressChan <- fmt.Sprintf("Deleting %s.", worker.Name)
+	instance := worker.InstanceName()
 
-	endpoint := fmt.Sprintf("https://www.googleapis.com/compute/v1/projects/%s/zones/%s/instances/%s",
-		op.GCloudProject, worker.Zone, worker.Name)
+	exp.ProgressChan <- fmt.Sprintf("Deleting %s.", instance)
 
-	// Create HTTP DELETE request.
-	request, err := http.NewRequest(http.MethodDelete, endpoint, nil)
+	start := time.Now()
+	err := op.deleteInstance(worker.Zone, instance)
+	deleteSeconds.Observe(time.Since(start).Seconds(), outcome(err))
 	if err != nil {
-		exp.ProgressChan <- fmt.Sprintf("Failed creating HTTP API request for %s: %v", worker.Name, err)
-		os.Exit(1)
+		exp.ProgressChan <- fmt.Sprintf("Failed deleting %s: %v", instance, err)
+		return err
 	}
-	request.Header.Set(http.CanonicalHeaderKey("authorization"), fmt.Sprintf("Bearer %s", op.GCloudAccessToken))
 
-	// Send the request to GCP.
-	resp, err := http.DefaultClient.Do(request)
-	for err != nil {
+	op.Lock()
+	worker.Spawned = false
+	op.Unlock()
 
-		exp.ProgressChan <- fmt.Sprintf("Delete API request for %s failed (will try again): %v", worker.Name, err)
-		time.Sleep(1 * time.Second)
+	op.persistWorker(exp, worker)
 
-		resp, err = http.DefaultClient.Do(request)
+	exp.ProgressChan <- fmt.Sprintf("Successfully deleted %s.", instance)
+
+	return nil
+}
+
+// spawnAll creates the instances of all supplied workers
+// in parallel, with at most the operator's spawn concurrency
+// of them in flight at once. A worker is spawned only after
+// all workers it depends on were spawned successfully. For
+// each worker that could not be spawned, failed is called.
+// Once spawns of the experiment are stopped, workers still
+// waiting are skipped. It returns how many spawns failed.
+func (op *Operator) spawnAll(exp *Exp, workers []*Worker, publiclyReachable bool,
+	deps map[string][]string, failed func(worker *Worker, err error)) int {
+
+	muFailed := &sync.Mutex{}
+	numFailed := 0
+
+	// Each worker's channel is closed once its spawn
+	// ended, success records whether it succeeded.
+	done := make(map[string]chan struct{})
+	success := make(map[string]bool)
+	for i := range workers {
+		done[workers[i].Name] = make(chan struct{})
 	}
 
-	// Read the response.
-	outRaw, err := ioutil.ReadAll(resp.Body)
+	pool := make(chan struct{}, op.SpawnConcurrency)
+	wg := &sync.WaitGroup{}
+
+	for i := range workers {
+
+		wg.Add(1)
+
+		go func(worker *Worker) {
+
+			defer wg.Done()
+			defer close(done[worker.Name])
+
+			var err error
+
+			for _, dep := range deps[worker.Name] {
+
+				depDone, found := done[dep]
+				if !found {
+					continue
+				}
+				<-depDone
+
+				muFailed.Lock()
+				depSucceeded := success[dep]
+				muFailed.Unlock()
+
+				if !depSucceeded {
+					err = fmt.Errorf("spawning instance %s skipped: %s it depends on failed", worker.Name, dep)
+					break
+				}
+			}
+
+			if err == nil {
+
+				select {
+				case pool <- struct{}{}:
+					err = op.SpawnInstance(exp, worker, publiclyReachable)
+					<-pool
+				case <-exp.SpawnsStopped:
+					err = fmt.Errorf("spawning instance %s skipped: experiment %s ended", worker.Name, exp.ID)
+				}
+			}
+
+			muFailed.Lock()
+			success[worker.Name] = err == nil
+			if err != nil {
+				numFailed++
+			}
+			muFailed.Unlock()
+
+			if err != nil {
+				failed(worker, err)
+			}
+		}(workers[i])
+	}
+
+	wg.Wait()
+
+	return numFailed
+}
+
+// spawnDeps returns for each server of an experiment
+// the servers that need to be spawned before it. Each
+// Vuvuzela mix depends on its successor, so that mixes
+// find their successor up when connecting to it.
+func spawnDeps(exp *Exp) map[string][]string {
+
+	deps := make(map[string][]string)
+
+	if exp.System != "vuvuzela" {
+		return deps
+	}
+
+	for i := 0; i < (len(exp.Servers) - 1); i++ {
+		deps[exp.Servers[i].Name] = []string{exp.Servers[(i + 1)].Name}
+	}
+
+	return deps
+}
+
+// shutdownAll deletes the instances of all supplied
+// workers in parallel and returns how many of these
+// deletions failed.
+func (op *Operator) shutdownAll(exp *Exp, workers []*Worker) int {
+
+	muFailed := &sync.Mutex{}
+	failed := 0
+
+	wg := &sync.WaitGroup{}
+
+	for i := range workers {
+
+		wg.Add(1)
+
+		go func(worker *Worker) {
+
+			defer wg.Done()
+
+			err := op.ShutdownInstance(exp, worker)
+			if err != nil {
+				muFailed.Lock()
+				failed++
+				muFailed.Unlock()
+			}
+		}(workers[i])
+	}
+
+	wg.Wait()
+
+	return failed
+}
+
+// TeardownInstances shuts down and deletes all client
+// machines of an experiment, followed by all server
+// machines. It returns whether all deletions succeeded.
+func (op *Operator) TeardownInstances(exp *Exp) bool {
+
+	// Shut down all client machines.
+	failedClients := op.shutdownAll(exp, exp.Clients)
+
+	exp.ProgressChan <- fmt.Sprintf("%d of %d clients successfully shut down.", (len(exp.Clients) - failedClients), len(exp.Clients))
+
+	// Shut down all server machines.
+	failedServers := op.shutdownAll(exp, exp.Servers)
+
+	exp.ProgressChan <- fmt.Sprintf("%d of %d servers successfully shut down.", (len(exp.Servers) - failedServers), len(exp.Servers))
+
+	return (failedClients + failedServers) == 0
+}
+
+// TeardownRecovered deletes all instances of an
+// experiment that was still in flight when a previous
+// operator process died. If any deletion fails, the
+// experiment stays marked as recovered so that the
+// teardown can be retried via the public API. The
+// trigger names what started this teardown attempt.
+func (op *Operator) TeardownRecovered(exp *Exp, trigger string) {
+
+	// Leaving the recovered state makes sure
+	// only one teardown runs at a time.
+	err := op.EnterExpState(exp, ExpTearingDown, fmt.Sprintf("teardown after operator restart, triggered by %s", trigger))
 	if err != nil {
-		exp.ProgressChan <- fmt.Sprintf("Failed reading from delete response body for %s: %v", worker.Name, err)
 		return
 	}
-	defer resp.Body.Close()
-	out := string(outRaw)
 
-	// Verify successful machine deletion.
-	if strings.Contains(out, "RUNNING") || strings.Contains(out, "DONE") {
-		exp.ProgressChan <- fmt.Sprintf("Successfully deleted %s.", worker.Name)
+	op.Lock()
+	exp.TeardownTrigger = trigger
+	op.Unlock()
+
+	exp.ProgressChan = make(chan string)
+	go exp.ProgressWriter(op.Store)
+
+	exp.ProgressChan <- fmt.Sprintf("Tearing down experiment %s that was in flight when the operator restarted.", exp.ID)
+
+	if op.TeardownInstances(exp) {
+		exp.ProgressChan <- fmt.Sprintf("Recovered experiment %s torn down.", exp.ID)
+		_ = op.EnterExpState(exp, ExpConcluded, "")
 	} else {
-		exp.ProgressChan <- fmt.Sprintf("Failed deleting %s: '%s'", worker.Name, out)
+		exp.ProgressChan <- fmt.Sprintf("Teardown of recovered experiment %s incomplete, terminate it again to retry.", exp.ID)
+		_ = op.EnterExpState(exp, ExpRecovered, "incomplete teardown")
+	}
+
+	close(exp.ProgressChan)
+}
+
+// spawnsStopped reports whether the experiment
+// ended, so that no more instances get created.
+func (exp *Exp) spawnsStopped() bool {
+
+	select {
+	case <-exp.SpawnsStopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// StopSpawns prevents any further instance of an
+// experiment from being created and waits for all
+// spawns still in flight, so that teardown finds
+// every instance and no spawn reports progress
+// after the experiment ended.
+func (op *Operator) StopSpawns(exp *Exp) {
+
+	close(exp.SpawnsStopped)
+	exp.Spawns.Wait()
+}
+
+// report hands the event of a failed spawn to the
+// goroutine conducting the experiment, unless the
+// experiment ended and nobody listens anymore.
+func (exp *Exp) report(event *WorkerEvent) {
+
+	select {
+	case exp.Events <- event:
+	case <-exp.SpawnsStopped:
+	}
+}
+
+// persistExp records a snapshot of the
+// experiment in the experiment store.
+func (op *Operator) persistExp(exp *Exp) {
+
+	op.Lock()
+	snapshot := exp.snapshot()
+	op.Unlock()
+
+	err := op.Store.SaveExp(snapshot)
+	if err != nil {
+		fmt.Printf("[STORE] Failed persisting experiment %s: %v\n", exp.ID, err)
+	}
+}
+
+// persistWorker records the current state of
+// a worker in the experiment store.
+func (op *Operator) persistWorker(exp *Exp, worker *Worker) {
+
+	op.Lock()
+	snapshot := worker.snapshot()
+	op.Unlock()
+
+	err := op.Store.SaveWorker(exp.ID, snapshot)
+	if err != nil {
+		fmt.Printf("[STORE] Failed persisting worker %s of experiment %s: %v\n", worker.Name, exp.ID, err)
+	}
+}
+
+// CompactStore replaces the experiment store's log
+// with one snapshot per experiment.
+func (op *Operator) CompactStore() error {
+
+	return op.Store.Compact(func() []*Exp {
+
+		op.Lock()
+		exps := make([]*Exp, 0, len(op.Exps))
+		snapshots := make([]*Exp, 0, len(op.Exps))
+		for expID := range op.Exps {
+			exps = append(exps, op.Exps[expID])
+			snapshots = append(snapshots, op.Exps[expID].snapshot())
+		}
+		op.Unlock()
+
+		for i := range snapshots {
+			snapshots[i].Progress, _ = exps[i].ProgressSince(0)
+		}
+
+		return snapshots
+	})
+}
+
+// RunStoreMaintenance periodically syncs progress
+// lines of the experiment store to stable storage
+// and compacts its log once it grew beyond maxSize
+// bytes and twice its size after the last compaction.
+func (op *Operator) RunStoreMaintenance(interval time.Duration, maxSize int64) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var compacted int64
+
+	for range ticker.C {
+
+		err := op.Store.Sync()
+		if err != nil {
+			fmt.Printf("[STORE] Failed syncing progress lines: %v\n", err)
+		}
+
+		size, err := op.Store.Size()
+		if err != nil || size <= maxSize || size <= (2 * compacted) {
+			continue
+		}
+
+		err = op.CompactStore()
+		if err != nil {
+			fmt.Printf("[STORE] Failed compacting log of %d bytes: %v\n", size, err)
+			continue
+		}
+
+		compacted, _ = op.Store.Size()
+
+		fmt.Printf("[STORE] Compacted log of %d bytes to %d bytes.\n", size, compacted)
 	}
 }
 
+// prepareChans creates all channels used to
+// communicate with the goroutine conducting
+// the experiment.
+func (exp *Exp) prepareChans() {
+
+	exp.ProgressChan = make(chan string)
+	exp.ProgressWake = make(chan struct{})
+	exp.TimedOutChan = make(chan *Worker)
+	exp.PreemptedChan = make(chan *Worker)
+	exp.TerminateChan = make(chan struct{}, 1)
+	exp.SpawnsStopped = make(chan struct{})
+
+	// Buffer worker events so that callbacks never
+	// wait for the runner to pick them up. Each worker
+	// legally sends at most three of them.
+	exp.Events = make(chan *WorkerEvent, ((3 * (len(exp.Servers) + len(exp.Clients))) + 10))
+}
+
 // ProgressWriter is the only routine allowed to append
 // time-stamped log lines to the progress slice of its
 // experiment. New lines are sent to it via the experiment's
-// progress channel.
-func (exp *Exp) ProgressWriter() {
+// progress channel. Each line is persisted to the
+// experiment store as well and wakes up all streams
+// following the experiment's progress.
+func (exp *Exp) ProgressWriter(store *Store) {
+
+	exp.ProgressLock.Lock()
+	if exp.ProgressWake == nil {
+		exp.ProgressWake = make(chan struct{})
+	}
+	exp.ProgressLock.Unlock()
 
 	for line := range exp.ProgressChan {
-		exp.Progress = append(exp.Progress, fmt.Sprintf("[%s] %s", time.Now().Format("2006-02-03 15:04:05"), line))
-		fmt.Printf(fmt.Sprintf("[%s] %s\n", time.Now().Format("2006-02-03 15:04:05"), line))
+
+		line = fmt.Sprintf("[%s] %s", time.Now().Format("2006-02-03 15:04:05"), line)
+
+		exp.ProgressLock.Lock()
+		exp.Progress = append(exp.Progress, line)
+		close(exp.ProgressWake)
+		exp.ProgressWake = make(chan struct{})
+		exp.ProgressLock.Unlock()
+
+		fmt.Printf("%s\n", line)
+
+		err := store.SaveProgress(exp.ID, line)
+		if err != nil {
+			fmt.Printf("[STORE] Failed persisting progress of experiment %s: %v\n", exp.ID, err)
+		}
 	}
+
+	exp.EndProgress()
 }
 
-// VuvuzelaProducePKI writes out the collected server
-// addresses into the otherwise prepared pki.conf file
-// that all Vuvuzela nodes use instead of an actual
-// PKI node.
-func (exp *Exp) VuvuzelaProducePKI() error {
+// EndProgress signals all streams following the
+// experiment's progress that no further lines
+// will be appended.
+func (exp *Exp) EndProgress() {
+
+	exp.ProgressLock.Lock()
+	defer exp.ProgressLock.Unlock()
+
+	if exp.ProgressWake != nil {
+		close(exp.ProgressWake)
+		exp.ProgressWake = nil
+	}
+}
+
+// ProgressSince returns a copy of all progress lines
+// starting at offset and a channel that is closed once
+// the next line is appended. If no further lines will
+// be appended, the returned channel is nil.
+func (exp *Exp) ProgressSince(offset int) ([]string, chan struct{}) {
+
+	exp.ProgressLock.Lock()
+	defer exp.ProgressLock.Unlock()
+
+	if offset >= len(exp.Progress) {
+		return nil, exp.ProgressWake
+	}
+
+	lines := make([]string, (len(exp.Progress) - offset))
+	copy(lines, exp.Progress[offset:])
+
+	return lines, exp.ProgressWake
+}
+
+// VuvuzelaPKI fills in the addresses of all servers
+// of an experiment into the template of pki.conf.
+func (exp *Exp) VuvuzelaPKI() ([]byte, error) {
 
 	// Read preliminary PKI file into memory.
 	pki, err := ioutil.ReadFile("/root/vuvuzela-confs/pki_tmpl.conf")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Replace all placeholders for a server's
@@ -450,12 +745,39 @@ func (exp *Exp) VuvuzelaProducePKI() error {
 		}
 	}
 
+	return pki, nil
+}
+
+// VuvuzelaProducePKI writes out the collected server
+// addresses into the otherwise prepared pki.conf file
+// that all Vuvuzela nodes use instead of an actual
+// PKI node. If bucketDir is set, it replaces the
+// GCloud bucket the file is uploaded to.
+func (exp *Exp) VuvuzelaProducePKI(bucketDir string) error {
+
+	pki, err := exp.VuvuzelaPKI()
+	if err != nil {
+		return err
+	}
+
 	// Write out final pki.conf.
 	err = ioutil.WriteFile("/root/vuvuzela-confs/pki.conf", pki, 0644)
 	if err != nil {
 		return err
 	}
 
+	// Local workers fetch pki.conf from the
+	// folder standing in for the bucket.
+	if bucketDir != "" {
+
+		err = os.MkdirAll(filepath.Join(bucketDir, "vuvuzela-confs"), 0755)
+		if err != nil {
+			return err
+		}
+
+		return runCmd("cp", "/root/vuvuzela-confs/pki.conf", filepath.Join(bucketDir, "vuvuzela-confs", "pki.conf"))
+	}
+
 	// Upload pki.conf to GCloud bucket.
 	out, err := exec.Command("/usr/bin/gsutil", "cp", "/root/vuvuzela-confs/pki.conf", "gs://acs-eval/vuvuzela-confs/pki.conf").CombinedOutput()
 	if err != nil {
@@ -469,300 +791,565 @@ func (exp *Exp) VuvuzelaProducePKI() error {
 	return nil
 }
 
-// RunExperiments is the authoritative goroutine
-// for provisioning machines and conducting all
-// experiments queued in the Operator.
-func (op *Operator) RunExperiments() {
+// phaseDeadline returns a channel that fires once
+// the timeout of a phase has passed. A timeout of
+// zero disables the deadline.
+func phaseDeadline(timeout time.Duration) <-chan time.Time {
 
-	for {
+	if timeout == 0 {
+		return nil
+	}
 
-		// Wait for new experiment to be queued.
-		expID := <-op.PublicNewChan
+	return time.After(timeout)
+}
 
-		op.Lock()
+// FailExp records the reason an experiment
+// failed and reports it as progress.
+func (op *Operator) FailExp(exp *Exp, reason string) {
 
-		// Mark this experiment as in progress.
-		op.ExpInProgress = expID
+	op.Lock()
+	exp.FailureReason = reason
+	op.Unlock()
 
-		// Retrieve experiment data.
-		exp := op.Exps[expID]
-
-		op.Unlock()
+	op.persistExp(exp)
 
-		// Launch progress writing routine.
-		go exp.ProgressWriter()
+	exp.ProgressChan <- fmt.Sprintf("Experiment %s failed: %s.", exp.ID, reason)
+}
 
-		exp.ProgressChan <- fmt.Sprintf("Commencing experiment %s for system %s with %d server and %d client instances.",
-			expID, exp.System, len(exp.Servers), len(exp.Clients))
+// TimeOutPhase marks all workers that did not reach one
+// of the supplied states before the deadline of a phase
+// as timed out and returns the reason for failing.
+func (op *Operator) TimeOutPhase(exp *Exp, workers []*Worker, phase string, timeout time.Duration, reached ...WorkerState) string {
 
-		// Prepare zeno evaluation control channel in
-		// case it is needed later on.
-		zenoEvalCtrlChan := make(chan struct{})
-
-		if exp.System == "zeno" {
-
-			// If zeno is being evaluated, initialize
-			// a PKI struct and have it listen in background.
-			op.ZenoPKI = &zenopki.PKI{
-				LisAddr:          fmt.Sprintf("%s:44001", strings.Split(op.InternalListenAddr, ":")[0]),
-				EvalCtrlChan:     zenoEvalCtrlChan,
-				AcceptMixRegs:    0,
-				AcceptClientRegs: 0,
-				MuNodes:          &sync.RWMutex{},
-				Nodes:            make(map[string]*zenopki.Endpoint),
-			}
+	timedOut := make([]string, 0, len(workers))
 
-			exp.ProgressChan <- fmt.Sprintf("Launching zeno PKI process at %s.", op.ZenoPKI.LisAddr)
+	for i := range workers {
 
-			// Run zeno PKI process in background.
-			go op.ZenoPKI.Run(op.TLSCertPath, op.TLSKeyPath)
+		if op.statusOf(workers[i]).in(reached) {
+			continue
 		}
 
-		// Spawn all server machines in reverse order.
-		// This hopefully enables Vuvuzela mixes to connect
-		// to their successor on first try.
-		for i := (len(exp.Servers) - 1); i >= 0; i-- {
-			op.SpawnInstance(exp, exp.Servers[i], true)
-			time.Sleep(1 * time.Second)
+		err := op.EnterWorkerState(exp, workers[i], WorkerTimedOut, fmt.Sprintf("%s phase exceeded its deadline", phase))
+		if err == nil {
+			timedOut = append(timedOut, workers[i].Name)
 		}
+	}
 
-		exp.ProgressChan <- fmt.Sprintf("All %d servers instructed to spawn, waiting for registration requests.", len(exp.Servers))
+	return fmt.Sprintf("%s phase exceeded its deadline of %s, timed out: %s", phase, timeout, strings.Join(timedOut, ", "))
+}
 
-		// Handle incoming registration requests.
-		for range exp.Servers {
+// TimeOutWorker marks a worker that stopped sending
+// heartbeats as timed out and returns the reason
+// for failing.
+func (op *Operator) TimeOutWorker(exp *Exp, worker *Worker) string {
 
-			select {
+	reason := fmt.Sprintf("worker %s sent no heartbeat for more than %s", worker.Name, op.HeartbeatTimeout)
 
-			case <-exp.TerminateChan:
-				exp.ProgressChan <- fmt.Sprintf("Terminating experiment %s", expID)
-				goto END
+	_ = op.EnterWorkerState(exp, worker, WorkerTimedOut, "no heartbeat")
 
-			case workerReg := <-exp.RegisterChan:
+	return reason
+}
 
-				_, found := exp.ServersMap[workerReg.Worker]
-				if found {
-					exp.ServersMap[workerReg.Worker].Address = workerReg.Address
-					exp.ServersMap[workerReg.Worker].Status = "registered"
-					exp.ProgressChan <- fmt.Sprintf("Server %s at %s marked as registered.", workerReg.Worker, workerReg.Address)
-				}
-			}
+// statusOf returns the status of a worker, which
+// respawns in background may change at any time.
+func (op *Operator) statusOf(worker *Worker) WorkerState {
+
+	op.Lock()
+	defer op.Unlock()
+
+	return worker.Status
+}
+
+// in reports whether the state is
+// one of the supplied ones.
+func (state WorkerState) in(states []WorkerState) bool {
+
+	for i := range states {
+
+		if state == states[i] {
+			return true
 		}
+	}
 
-		if exp.System == "vuvuzela" {
+	return false
+}
 
-			// If Vuvuzela is being evaluated, we need to
-			// quickly produce an appropriate pki.conf file.
-			err := exp.VuvuzelaProducePKI()
-			if err != nil {
-				exp.ProgressChan <- fmt.Sprintf("Failed to produce final pki.conf file for Vuvuzela: %v", err)
-				os.Exit(1)
-			}
+// WatchHeartbeats reports each registered worker of
+// an experiment whose last heartbeat is older than
+// the heartbeat timeout via the experiment's timed-out
+// channel. A heartbeat timeout of zero disables it.
+func (op *Operator) WatchHeartbeats(exp *Exp, stop chan struct{}) {
 
-			exp.ProgressChan <- "pki.conf for Vuvuzela created and uploaded."
+	if op.HeartbeatTimeout == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(op.HeartbeatTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
 		}
 
-		// Handle incoming ready or failed requests.
-		for range exp.Servers {
+		var silent *Worker
 
-			select {
+		op.Lock()
 
-			case <-exp.TerminateChan:
-				exp.ProgressChan <- fmt.Sprintf("Terminating experiment %s", expID)
-				goto END
+		for _, workers := range [][]*Worker{exp.Servers, exp.Clients} {
 
-			case workerName := <-exp.ReadyChan:
+			for i := range workers {
 
-				_, found := exp.ServersMap[workerName]
-				if found {
-					exp.ServersMap[workerName].Status = "ready"
-					exp.ProgressChan <- fmt.Sprintf("Server %s marked as ready.", workerName)
+				// Only workers that registered
+				// and did not yet end send heartbeats.
+				if workers[i].Status != WorkerRegistered && workers[i].Status != WorkerReady {
+					continue
 				}
 
-			case failedReq := <-exp.FailedChan:
-
-				_, found := exp.ServersMap[failedReq.Worker]
-				if found {
-					exp.ServersMap[failedReq.Worker].Status = "failed"
-					exp.ProgressChan <- fmt.Sprintf("Server %s failed with: %s", failedReq.Worker, failedReq.Reason)
+				if time.Since(workers[i].LastHeartbeat) > op.HeartbeatTimeout {
+					silent = workers[i]
 				}
 			}
 		}
 
-		// Verify all servers ready.
-		for i := range exp.Servers {
+		op.Unlock()
+
+		if silent != nil {
 
-			if exp.Servers[i].Status != "ready" {
-				exp.ProgressChan <- fmt.Sprintf("At least one server (%s) failed to initialize, ending experiment %s.",
-					exp.Servers[i].Name, expID)
-				goto CONFIRM_END
+			select {
+			case exp.TimedOutChan <- silent:
+			case <-stop:
+				return
 			}
 		}
+	}
+}
 
-		exp.ProgressChan <- fmt.Sprintf("All %d servers spawned and ready, launching clients.", len(exp.Servers))
+// worker returns the server or client
+// of an experiment with supplied name.
+func (exp *Exp) worker(name string) (*Worker, bool) {
 
-		// Spawn all client machines.
-		for i := range exp.Clients {
-			go op.SpawnInstance(exp, exp.Clients[i], false)
-		}
+	worker, found := exp.ServersMap[name]
+	if !found {
+		worker, found = exp.ClientsMap[name]
+	}
 
-		exp.ProgressChan <- fmt.Sprintf("All %d clients instructed to spawn, waiting for registration requests.", len(exp.Clients))
+	return worker, found
+}
 
-		// Handle incoming client registration requests.
-		for range exp.Clients {
+// applyEvent moves the worker named in an event to
+// the state the event signals. Events that do not
+// represent a legal transition, e.g., a second
+// 'finished' from the same worker, are rejected.
+func (op *Operator) applyEvent(exp *Exp, event *WorkerEvent) {
 
-			select {
+	worker, found := exp.worker(event.Worker)
+	if !found {
+		return
+	}
 
-			case <-exp.TerminateChan:
-				exp.ProgressChan <- fmt.Sprintf("Terminating experiment %s", expID)
-				goto END
+	if event.Address != "" {
+		op.Lock()
+		worker.Address = event.Address
+		op.Unlock()
+	}
 
-			case workerReg := <-exp.RegisterChan:
+	err := op.EnterWorkerState(exp, worker, event.State, event.Reason)
+	if err != nil {
+		exp.ProgressChan <- fmt.Sprintf("Rejected callback of %s: %v.", event.Worker, err)
+	}
+}
 
-				_, found := exp.ClientsMap[workerReg.Worker]
-				if found {
-					exp.ClientsMap[workerReg.Worker].Status = "registered"
-					exp.ProgressChan <- fmt.Sprintf("Client %s marked as registered.", workerReg.Worker)
-				}
+// AwaitPhase applies all worker events to the states
+// of the experiment's workers until every worker of the
+// phase reached one of the supplied states or ended. It
+// returns the state the experiment moves on to if the
+// phase got cut short by termination, deadline, or a
+// silent worker, and an empty state otherwise.
+func (op *Operator) AwaitPhase(exp *Exp, workers []*Worker, phase string, timeout time.Duration, reached ...WorkerState) ExpState {
+
+	deadline := phaseDeadline(timeout)
+	ended := append([]WorkerState{WorkerFailed, WorkerTimedOut, WorkerPreempted}, reached...)
+
+	for {
+
+		// Check whether phase is complete.
+		op.Lock()
+		complete := true
+		for i := range workers {
+
+			if !workers[i].Status.in(ended) {
+				complete = false
 			}
 		}
+		op.Unlock()
+
+		if complete {
+			return ""
+		}
 
-		// Handle incoming ready or failed requests.
-		for range exp.Clients {
+		select {
 
-			select {
+		case <-exp.TerminateChan:
+			exp.ProgressChan <- fmt.Sprintf("Terminating experiment %s", exp.ID)
+			return ExpTearingDown
 
-			case <-exp.TerminateChan:
-				exp.ProgressChan <- fmt.Sprintf("Terminating experiment %s", expID)
-				goto END
+		case <-deadline:
 
-			case workerName := <-exp.ReadyChan:
+			reason := op.TimeOutPhase(exp, workers, phase, timeout, reached...)
 
-				_, found := exp.ClientsMap[workerName]
-				if found {
-					exp.ClientsMap[workerName].Status = "ready"
-					exp.ProgressChan <- fmt.Sprintf("Client %s marked as ready.", workerName)
+			// All remaining workers timed out, which
+			// completes the phase if they are clients
+			// within the experiment's tolerance.
+			if op.BeyondTolerance(exp) == "" {
+				exp.ProgressChan <- fmt.Sprintf("Tolerating failed clients: %s.", reason)
+				return ""
+			}
+
+			op.FailExp(exp, reason)
+			return ExpAwaitingShutdown
+
+		case worker := <-exp.TimedOutChan:
+
+			// Registered workers that went silent,
+			// e.g., preempted ones, get replaced.
+			if op.mayRespawn(exp, worker, WorkerRegistered) {
+				op.Respawn(exp, worker, "no heartbeat")
+				continue
+			}
+
+			reason := op.TimeOutWorker(exp, worker)
+
+			if op.BeyondTolerance(exp) == "" {
+				exp.ProgressChan <- fmt.Sprintf("Tolerating failed clients: %s.", reason)
+				continue
+			}
+
+			op.FailExp(exp, reason)
+			return ExpAwaitingShutdown
+
+		case worker := <-exp.PreemptedChan:
+
+			reason := op.HandlePreemption(exp, worker)
+			if reason != "" {
+				op.FailExp(exp, reason)
+				return ExpAwaitingShutdown
+			}
+
+		case event := <-exp.Events:
+
+			// Registered workers that failed
+			// to initialize get replaced.
+			if event.State == WorkerFailed {
+
+				worker, found := exp.worker(event.Worker)
+				if found && op.mayRespawn(exp, worker, WorkerRegistered) {
+					op.Respawn(exp, worker, event.Reason)
+					continue
 				}
+			}
+
+			op.applyEvent(exp, event)
 
-			case failedReq := <-exp.FailedChan:
+			// Failures beyond the experiment's
+			// tolerance end it right away.
+			if event.State == WorkerFailed {
 
-				_, found := exp.ClientsMap[failedReq.Worker]
-				if found {
-					exp.ClientsMap[failedReq.Worker].Status = "failed"
-					exp.ProgressChan <- fmt.Sprintf("Client %s failed with: %s", failedReq.Worker, failedReq.Reason)
+				reason := op.BeyondTolerance(exp)
+				if reason != "" {
+					op.FailExp(exp, reason)
+					return ExpAwaitingShutdown
 				}
 			}
 		}
+	}
+}
+
+// ConductExp provisions all machines of an experiment
+// and drives it through all phases. It returns the state
+// the experiment moves on to afterwards: awaiting shutdown
+// confirmation if it ran to its end or failed, tearing
+// down if it got terminated.
+func (op *Operator) ConductExp(exp *Exp) ExpState {
+
+	// Prepare zeno evaluation control channel in
+	// case it is needed later on.
+	zenoEvalCtrlChan := make(chan struct{})
+
+	if exp.System == "zeno" {
+
+		// If zeno is being evaluated, initialize
+		// a PKI struct and have it listen in background.
+		op.ZenoPKI = &zenopki.PKI{
+			LisAddr:          fmt.Sprintf("%s:44001", strings.Split(op.InternalListenAddr, ":")[0]),
+			EvalCtrlChan:     zenoEvalCtrlChan,
+			AcceptMixRegs:    0,
+			AcceptClientRegs: 0,
+			MuNodes:          &sync.RWMutex{},
+			Nodes:            make(map[string]*zenopki.Endpoint),
+		}
+
+		exp.ProgressChan <- fmt.Sprintf("Launching zeno PKI process at %s.", op.ZenoPKI.LisAddr)
+
+		// Run zeno PKI process in background.
+		go op.ZenoPKI.Run(op.TLSCertPath, op.TLSKeyPath)
+	}
+
+	// Watch for workers that stop sending heartbeats.
+	stopWatchdog := make(chan struct{})
+	defer close(stopWatchdog)
+	go op.WatchHeartbeats(exp, stopWatchdog)
+	go op.WatchPreemptions(exp, stopWatchdog)
+
+	// Spawn all server machines, each only after
+	// the ones it depends on. A termination request
+	// meanwhile cuts spawns still pending short.
+	serversSpawned := make(chan int, 1)
+	exp.Spawns.Add(1)
+	go func() {
 
-		// Verify all clients ready.
-		for i := range exp.Clients {
+		defer exp.Spawns.Done()
 
-			if exp.Clients[i].Status != "ready" {
-				exp.ProgressChan <- fmt.Sprintf("At least one client (%s) failed to initialize, ending experiment %s.",
-					exp.Clients[i].Name, expID)
-				goto CONFIRM_END
+		serversSpawned <- op.spawnAll(exp, exp.Servers, true, spawnDeps(exp), func(worker *Worker, err error) {
+
+			if exp.spawnsStopped() {
+				return
 			}
+
+			_ = op.EnterWorkerState(exp, worker, WorkerFailed, "instance creation failed")
+			op.FailExp(exp, err.Error())
+		})
+	}()
+
+	select {
+
+	case failedServers := <-serversSpawned:
+		if failedServers > 0 {
+			return ExpAwaitingShutdown
 		}
 
-		if exp.System == "zeno" {
+	case <-exp.TerminateChan:
+		exp.ProgressChan <- fmt.Sprintf("Terminating experiment %s", exp.ID)
+		return ExpTearingDown
+	}
+
+	exp.ProgressChan <- fmt.Sprintf("All %d servers instructed to spawn, waiting for registration requests.", len(exp.Servers))
 
-			// If ACS under evaluation is zeno, signal
-			// PKI routine to start broadcasting.
-			zenoEvalCtrlChan <- struct{}{}
+	// Handle incoming registration requests.
+	next := op.AwaitPhase(exp, exp.Servers, "server registration", op.RegisterTimeout, WorkerRegistered, WorkerReady)
+	if next != "" {
+		return next
+	}
+
+	if exp.System == "vuvuzela" {
+
+		// If Vuvuzela is being evaluated, we need to
+		// quickly produce an appropriate pki.conf file.
+		err := exp.VuvuzelaProducePKI(op.LocalBucketDir)
+		if err != nil {
+			op.FailExp(exp, fmt.Sprintf("producing final pki.conf file for Vuvuzela failed: %v", err))
+			return ExpAwaitingShutdown
 		}
 
-		// Wait for all nodes to signal completion.
-		for i := 0; i < (len(exp.Servers) + len(exp.Clients)); i++ {
+		exp.ProgressChan <- "pki.conf for Vuvuzela created and uploaded."
 
-			select {
+		// Respawned servers would not match
+		// the addresses in pki.conf anymore.
+		op.Lock()
+		exp.ServersFixed = true
+		op.Unlock()
+	}
 
-			case <-exp.TerminateChan:
-				exp.ProgressChan <- fmt.Sprintf("Terminating experiment %s", expID)
-				goto END
+	// Handle incoming ready or failed requests.
+	next = op.AwaitPhase(exp, exp.Servers, "server initialization", op.ReadyTimeout, WorkerReady)
+	if next != "" {
+		return next
+	}
 
-			case workerName := <-exp.FinishedChan:
+	// Verify all servers ready.
+	for i := range exp.Servers {
 
-				_, found := exp.ServersMap[workerName]
-				if found {
-					exp.ServersMap[workerName].Status = "finished"
-					exp.ProgressChan <- fmt.Sprintf("Server %s marked as finished.", workerName)
-				}
+		if op.statusOf(exp.Servers[i]) != WorkerReady {
+			exp.ProgressChan <- fmt.Sprintf("At least one server (%s) failed to initialize, ending experiment %s.",
+				exp.Servers[i].Name, exp.ID)
+			return ExpAwaitingShutdown
+		}
+	}
 
-				_, found = exp.ClientsMap[workerName]
-				if found {
-					exp.ClientsMap[workerName].Status = "finished"
-					exp.ProgressChan <- fmt.Sprintf("Client %s marked as finished.", workerName)
-				}
+	exp.ProgressChan <- fmt.Sprintf("All %d servers spawned and ready, launching clients.", len(exp.Servers))
+	op.notify(exp, EventServersReady, "", "")
 
-			case failedReq := <-exp.FailedChan:
+	// Spawn all client machines.
+	// Registrations of early clients are handled
+	// while later ones are still being spawned.
+	exp.Spawns.Add(1)
+	go func() {
 
-				_, found := exp.ServersMap[failedReq.Worker]
-				if found {
-					exp.ServersMap[failedReq.Worker].Status = "failed"
-					exp.ProgressChan <- fmt.Sprintf("Server %s failed with: %s", failedReq.Worker, failedReq.Reason)
-				}
+		defer exp.Spawns.Done()
 
-				_, found = exp.ClientsMap[failedReq.Worker]
-				if found {
-					exp.ClientsMap[failedReq.Worker].Status = "failed"
-					exp.ProgressChan <- fmt.Sprintf("Client %s failed with: %s", failedReq.Worker, failedReq.Reason)
-				}
-			}
+		op.spawnAll(exp, exp.Clients, false, nil, func(worker *Worker, err error) {
+			exp.report(&WorkerEvent{
+				Worker: worker.Name,
+				State:  WorkerFailed,
+				Reason: fmt.Sprintf("instance creation failed: %v", err),
+			})
+		})
+	}()
+
+	exp.ProgressChan <- fmt.Sprintf("All %d clients instructed to spawn, waiting for registration requests.", len(exp.Clients))
+
+	// Handle incoming client registration requests.
+	next = op.AwaitPhase(exp, exp.Clients, "client registration", op.RegisterTimeout, WorkerRegistered, WorkerReady)
+	if next != "" {
+		return next
+	}
+
+	// Handle incoming ready or failed requests.
+	next = op.AwaitPhase(exp, exp.Clients, "client initialization", op.ReadyTimeout, WorkerReady)
+	if next != "" {
+		return next
+	}
+
+	// Verify enough clients ready.
+	reason := op.BeyondTolerance(exp)
+	if reason != "" {
+		op.FailExp(exp, reason)
+		return ExpAwaitingShutdown
+	}
+
+	op.notify(exp, EventClientsReady, "", "")
+
+	// Analyses need to know who conversed with whom.
+	// Zone fallback might have moved clients, thus
+	// the pairing is final only once all are ready.
+	err := exp.UploadPairing(op.LocalBucketDir)
+	if err != nil {
+		exp.ProgressChan <- fmt.Sprintf("Failed to upload pairing of clients: %v", err)
+	} else {
+		exp.ProgressChan <- fmt.Sprintf("Pairing '%s' (seed %d) of clients uploaded.", exp.Pairing, exp.PairingSeed)
+	}
+
+	err = op.EnterExpState(exp, ExpRunning, "")
+	if err != nil {
+		exp.ProgressChan <- fmt.Sprintf("Failed to start experiment %s: %v", exp.ID, err)
+		return ExpAwaitingShutdown
+	}
+
+	if exp.System == "zeno" {
+
+		// If ACS under evaluation is zeno, signal
+		// PKI routine to start broadcasting.
+		zenoEvalCtrlChan <- struct{}{}
+	}
+
+	allWorkers := make([]*Worker, 0, (len(exp.Servers) + len(exp.Clients)))
+	allWorkers = append(allWorkers, exp.Servers...)
+	allWorkers = append(allWorkers, exp.Clients...)
+
+	// Wait for all nodes to signal completion.
+	next = op.AwaitPhase(exp, allWorkers, "execution", op.FinishTimeout, WorkerFinished)
+	if next != "" {
+		return next
+	}
+
+	// Verify all servers completed.
+	for i := range exp.Servers {
+
+		if op.statusOf(exp.Servers[i]) != WorkerFinished {
+			exp.ProgressChan <- fmt.Sprintf("At least one server (%s) did not finish in experiment %s.",
+				exp.Servers[i].Name, exp.ID)
 		}
+	}
 
-		// Verify all servers completed.
-		for i := range exp.Servers {
+	// Verify all clients completed.
+	for i := range exp.Clients {
 
-			if exp.Servers[i].Status != "finished" {
-				exp.ProgressChan <- fmt.Sprintf("At least one server (%s) did not finish in experiment %s.",
-					exp.Servers[i].Name, expID)
-			}
+		if op.statusOf(exp.Clients[i]) != WorkerFinished {
+			exp.ProgressChan <- fmt.Sprintf("At least one client (%s) did not finish in experiment %s.",
+				exp.Clients[i].Name, exp.ID)
 		}
+	}
 
-		// Verify all clients completed.
-		for i := range exp.Clients {
+	// Record tolerated failed clients for
+	// analyses to exclude their measurements.
+	failed := op.FailedClients(exp)
+	if len(failed.Workers) > 0 {
 
-			if exp.Clients[i].Status != "finished" {
-				exp.ProgressChan <- fmt.Sprintf("At least one client (%s) did not finish in experiment %s.",
-					exp.Clients[i].Name, expID)
-			}
+		err = exp.UploadFailedClients(op.LocalBucketDir, failed)
+		if err != nil {
+			exp.ProgressChan <- fmt.Sprintf("Failed to upload record of failed clients: %v", err)
+		} else {
+			exp.ProgressChan <- fmt.Sprintf("Record of %d failed clients (%d logical clients excluded) uploaded.",
+				len(failed.Workers), len(failed.ExcludedClients))
 		}
+	}
 
-	CONFIRM_END:
+	return ExpAwaitingShutdown
+}
 
-		exp.ProgressChan <- fmt.Sprintf("Experiment %s reached end, awaiting shutdown confirmation.", expID)
+// RunExperiments is the authoritative goroutine
+// for provisioning machines and conducting all
+// experiments queued in the Operator.
+func (op *Operator) RunExperiments() {
 
-		// Wait for explicit shutdown confirmation.
-		<-exp.TerminateChan
+	for {
+
+		// Wait for next experiment in queue.
+		expID := op.Queue.Pop()
 
-		exp.ProgressChan <- fmt.Sprintf("Shutdown confirmation for experiment %s received.", expID)
+		op.Lock()
 
-	END:
-		// Shut down all client machines.
-		wg := &sync.WaitGroup{}
+		// Mark this experiment as in progress.
+		op.ExpInProgress = expID
 
-		for i := 0; i < len(exp.Clients); i++ {
-			wg.Add(1)
-			go op.ShutdownInstance(wg, exp, exp.Clients[i])
+		// Retrieve experiment data.
+		exp := op.Exps[expID]
+		exp.QueuePosition = 0
+
+		op.Unlock()
+
+		// Launch progress writing routine.
+		go exp.ProgressWriter(op.Store)
+
+		err := op.EnterExpState(exp, ExpProvisioning, "")
+		if err != nil {
+			fmt.Printf("[RUNNER] Skipping experiment %s: %v\n", expID, err)
+			close(exp.ProgressChan)
+			continue
 		}
 
-		wg.Wait()
+		exp.ProgressChan <- fmt.Sprintf("Commencing experiment %s for system %s with %d server and %d client instances.",
+			expID, exp.System, len(exp.Servers), len(exp.Clients))
+
+		next := op.ConductExp(exp)
+		trigger := op.terminateTrigger(exp, "termination request")
 
-		exp.ProgressChan <- fmt.Sprintf("All %d clients successfully shut down.", len(exp.Clients))
+		// Nothing gets spawned anymore once the
+		// experiment ended or got terminated.
+		op.StopSpawns(exp)
 
-		// Shut down all server machines.
-		wg = &sync.WaitGroup{}
+		if next == ExpAwaitingShutdown {
 
-		for i := 0; i < len(exp.Servers); i++ {
-			wg.Add(1)
-			go op.ShutdownInstance(wg, exp, exp.Servers[i])
+			_ = op.EnterExpState(exp, ExpAwaitingShutdown, exp.FailureReason)
+
+			// Wait for the teardown policy or an
+			// explicit shutdown confirmation.
+			trigger = op.AwaitTeardown(exp)
 		}
 
-		wg.Wait()
+		op.Lock()
+		exp.TeardownTrigger = trigger
+		op.Unlock()
 
-		exp.ProgressChan <- fmt.Sprintf("All %d servers successfully shut down.", len(exp.Servers))
+		// Shut down all machines.
+		_ = op.EnterExpState(exp, ExpTearingDown, fmt.Sprintf("triggered by %s", trigger))
+		_ = op.TeardownInstances(exp)
 
 		// Mark experiment as done.
-		exp.Concluded = true
+		_ = op.EnterExpState(exp, ExpConcluded, "")
 		close(exp.ProgressChan)
 
 		op.Lock()
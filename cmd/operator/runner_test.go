@@ -0,0 +1,416 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gatedProvider holds back the creation of
+// instances until its gate gets closed.
+type gatedProvider struct {
+	Provider
+	Gate chan struct{}
+}
+
+// CreateInstance waits for the gate to
+// open before creating the instance.
+func (gated *gatedProvider) CreateInstance(spec *InstanceSpec) error {
+
+	<-gated.Gate
+
+	return gated.Provider.CreateInstance(spec)
+}
+
+// newTestOperator returns an operator that conducts the
+// experiments queued at it on instances of the supplied
+// provider, keeping its store and results in a temporary
+// folder.
+func newTestOperator(t *testing.T, provider Provider, registerTimeout time.Duration) (*Operator, func()) {
+
+	dir, err := ioutil.TempDir("", "acs-runner")
+	if err != nil {
+		t.Fatalf("failed creating temporary directory: %v", err)
+	}
+
+	op := &Operator{
+		InternalListenAddr: "127.0.0.1:443",
+		Queue:              NewExpQueue(),
+		Provider:           provider,
+		LocalBucketDir:     filepath.Join(dir, "bucket"),
+
+		RegisterTimeout: registerTimeout,
+		ReadyTimeout:    (5 * time.Second),
+		FinishTimeout:   (5 * time.Second),
+
+		CreateRetries:    2,
+		CreateBackoff:    (10 * time.Millisecond),
+		CreateBackoffMax: (50 * time.Millisecond),
+
+		TeardownPolicy:   "on-finish",
+		SpawnConcurrency: 2,
+
+		ExpHooks:    make(map[ExpState][]ExpHook),
+		WorkerHooks: make(map[WorkerState][]WorkerHook),
+	}
+
+	op.RegisterDefaultHooks()
+
+	op.Store, op.Exps, err = OpenStore(filepath.Join(dir, "exps.log"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed opening store: %v", err)
+	}
+
+	go op.RunExperiments()
+
+	return op, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+// submitTestExp queues an experiment with one server
+// and two client machines the way the public API does.
+func submitTestExp(t *testing.T, op *Operator) *Exp {
+
+	worker := func(id int, name string, typeOfNode string) *Worker {
+		return &Worker{
+			ID:          id,
+			Name:        name,
+			Zone:        "europe-west1-b",
+			MachineType: "n1-standard-4",
+			TypeOfNode:  typeOfNode,
+			SourceImage: "acs",
+			DiskType:    "pd-ssd",
+			DiskSize:    "10",
+		}
+	}
+
+	exp, err := ExpFromReq(&ExpReq{
+		System:            "pung",
+		ResultFolder:      "results",
+		ClientsPerMachine: 2,
+		TeardownPolicy:    op.TeardownPolicy,
+		Servers:           []*Worker{worker(1, "server-00001", "server")},
+		Clients:           []*Worker{worker(1, "client-00001", "client"), worker(2, "client-00002", "client")},
+	})
+	if err != nil {
+		t.Fatalf("invalid experiment: %v", err)
+	}
+
+	exp.ID = fmt.Sprintf("%016x", time.Now().UnixNano())
+	exp.State = ExpQueued
+	exp.Transitions = []*Transition{{To: string(ExpQueued), At: time.Now()}}
+	exp.Queued = true
+	exp.QueuedAt = time.Now().UnixNano()
+	exp.prepareChans()
+
+	op.Lock()
+	op.Exps[exp.ID] = exp
+	op.Unlock()
+
+	op.persistExp(exp)
+
+	op.Lock()
+	exp.QueuePosition = op.Queue.Push(exp.ID, exp.Priority, exp.QueuedAt)
+	op.Unlock()
+
+	return exp
+}
+
+// expState returns the current state of
+// the experiment under the operator lock.
+func expState(op *Operator, exp *Exp) ExpState {
+
+	op.Lock()
+	defer op.Unlock()
+
+	return exp.State
+}
+
+// runFakeWorker plays the supplied worker: once its
+// instance runs with the worker's token in its metadata,
+// it reports the scripted states to the runner in order,
+// 'finished' only after the experiment started running.
+func runFakeWorker(op *Operator, mem *MemProvider, exp *Exp, worker *Worker, script []WorkerState, stop chan struct{}) {
+
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+
+	// await waits until cond holds
+	// or the test is over.
+	await := func(cond func() bool) bool {
+
+		for !cond() {
+
+			select {
+			case <-stop:
+				return false
+			case <-ticker.C:
+			}
+		}
+
+		return true
+	}
+
+	booted := await(func() bool {
+
+		op.Lock()
+		token := worker.Token
+		op.Unlock()
+
+		return token != "" && mem.MetadataOf(worker.InstanceName(), "workerToken") == token
+	})
+	if !booted {
+		return
+	}
+
+	for _, state := range script {
+
+		if state == WorkerFinished && !await(func() bool { return expState(op, exp) == ExpRunning }) {
+			return
+		}
+
+		event := &WorkerEvent{
+			Worker: worker.Name,
+			State:  state,
+		}
+
+		if state == WorkerRegistered {
+			event.Address = fmt.Sprintf("10.0.0.%d:33001", worker.ID)
+		} else if state == WorkerFailed {
+			event.Reason = "scripted failure"
+		}
+
+		// Deliver the event the way the
+		// internal API handlers do.
+		delivered := await(func() bool {
+
+			op.Lock()
+			defer op.Unlock()
+
+			if exp.State != ExpProvisioning && exp.State != ExpRunning {
+				return true
+			}
+
+			select {
+			case exp.Events <- event:
+				worker.Reported = state
+				return true
+			default:
+				return false
+			}
+		})
+		if !delivered {
+			return
+		}
+	}
+}
+
+// awaitProgress waits until the progress of an
+// experiment contains a line with supplied text.
+func awaitProgress(t *testing.T, exp *Exp, text string) {
+
+	deadline := time.After(10 * time.Second)
+
+	for {
+
+		lines, wake := exp.ProgressSince(0)
+		for i := range lines {
+
+			if strings.Contains(lines[i], text) {
+				return
+			}
+		}
+
+		if wake == nil {
+			t.Fatalf("progress of experiment ended without line containing '%s'", text)
+		}
+
+		select {
+		case <-wake:
+		case <-deadline:
+			t.Fatalf("expected progress line containing '%s', got: %v", text, lines)
+		}
+	}
+}
+
+// awaitState waits until the experiment
+// reached the supplied state.
+func awaitState(t *testing.T, op *Operator, exp *Exp, state ExpState) {
+
+	deadline := time.After(10 * time.Second)
+
+	for expState(op, exp) != state {
+
+		select {
+		case <-time.After(5 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("expected experiment in state '%s', got '%s'", state, expState(op, exp))
+		}
+	}
+}
+
+func TestConductExp(t *testing.T) {
+
+	success := []WorkerState{WorkerRegistered, WorkerReady, WorkerFinished}
+
+	tests := []struct {
+		name            string
+		scripts         map[string][]WorkerState
+		registerTimeout time.Duration
+		gated           bool
+		terminateAfter  string
+		trigger         string
+		failed          bool
+		statuses        map[string]WorkerState
+	}{
+		{
+			name:    "success",
+			trigger: "policy 'on-finish'",
+			statuses: map[string]WorkerState{
+				"server-00001": WorkerFinished,
+				"client-00001": WorkerFinished,
+				"client-00002": WorkerFinished,
+			},
+		},
+		{
+			name: "worker failure",
+			scripts: map[string][]WorkerState{
+				"client-00002": {WorkerRegistered, WorkerFailed},
+			},
+			trigger: "policy 'on-finish'",
+			failed:  true,
+			statuses: map[string]WorkerState{
+				"server-00001": WorkerReady,
+				"client-00002": WorkerFailed,
+			},
+		},
+		{
+			name: "registration timeout",
+			scripts: map[string][]WorkerState{
+				"server-00001": {},
+			},
+			registerTimeout: (300 * time.Millisecond),
+			trigger:         "policy 'on-finish'",
+			failed:          true,
+			statuses: map[string]WorkerState{
+				"server-00001": WorkerTimedOut,
+				"client-00001": WorkerPending,
+				"client-00002": WorkerPending,
+			},
+		},
+		{
+			name: "terminate while running",
+			scripts: map[string][]WorkerState{
+				"server-00001": {WorkerRegistered, WorkerReady},
+				"client-00001": {WorkerRegistered, WorkerReady},
+				"client-00002": {WorkerRegistered, WorkerReady},
+			},
+			terminateAfter: "Pairing 'same-machine'",
+			trigger:        "termination request",
+			statuses: map[string]WorkerState{
+				"server-00001": WorkerReady,
+				"client-00001": WorkerReady,
+				"client-00002": WorkerReady,
+			},
+		},
+		{
+			name:           "terminate while spawning servers",
+			gated:          true,
+			terminateAfter: "Spawning server-00001",
+			trigger:        "termination request",
+			statuses: map[string]WorkerState{
+				"server-00001": WorkerPending,
+				"client-00001": WorkerPending,
+				"client-00002": WorkerPending,
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			mem := NewMemProvider(nil, 0, "")
+
+			gated := &gatedProvider{Provider: mem, Gate: make(chan struct{})}
+			if !test.gated {
+				close(gated.Gate)
+			}
+
+			registerTimeout := test.registerTimeout
+			if registerTimeout == 0 {
+				registerTimeout = (5 * time.Second)
+			}
+
+			op, cleanup := newTestOperator(t, gated, registerTimeout)
+			defer cleanup()
+
+			exp := submitTestExp(t, op)
+
+			stop := make(chan struct{})
+			defer close(stop)
+
+			for _, workers := range [][]*Worker{exp.Servers, exp.Clients} {
+
+				for i := range workers {
+
+					script, found := test.scripts[workers[i].Name]
+					if !found {
+						script = success
+					}
+
+					go runFakeWorker(op, mem, exp, workers[i], script, stop)
+				}
+			}
+
+			if test.terminateAfter != "" {
+
+				awaitProgress(t, exp, test.terminateAfter)
+				op.SignalTerminate(exp, "")
+
+				// Instances still being created
+				// are only let through afterwards.
+				if test.gated {
+					awaitProgress(t, exp, "Terminating experiment")
+					close(gated.Gate)
+				}
+			}
+
+			awaitState(t, op, exp, ExpConcluded)
+
+			op.Lock()
+			defer op.Unlock()
+
+			if exp.TeardownTrigger != test.trigger {
+				t.Errorf("expected teardown triggered by %s, got: %s", test.trigger, exp.TeardownTrigger)
+			}
+
+			if exp.Failed() != test.failed {
+				t.Errorf("expected experiment failed to be %v, got failure reason '%s'", test.failed, exp.FailureReason)
+			}
+
+			for name, status := range test.statuses {
+
+				worker, _ := exp.worker(name)
+				if worker.Status != status {
+					t.Errorf("expected %s in state '%s', got '%s'", name, status, worker.Status)
+				}
+			}
+
+			instances, err := mem.ListInstances()
+			if err != nil {
+				t.Fatalf("failed listing instances: %v", err)
+			}
+
+			if len(instances) != 0 {
+				t.Errorf("expected all instances deleted, %d remain", len(instances))
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// ExpState is the stage an experiment
+// is in over its lifetime.
+type ExpState string
+
+// All states an experiment moves through. Recovered
+// experiments were in flight when a previous operator
+// process died and await the deletion of their instances.
+const (
+	ExpQueued           ExpState = "queued"
+	ExpProvisioning     ExpState = "provisioning"
+	ExpRunning          ExpState = "running"
+	ExpAwaitingShutdown ExpState = "awaiting-shutdown"
+	ExpTearingDown      ExpState = "tearing-down"
+	ExpRecovered        ExpState = "recovered"
+	ExpConcluded        ExpState = "concluded"
+)
+
+// WorkerState is the stage a worker of
+// an experiment is in.
+type WorkerState string
+
+// All states a worker moves through. Failed and
+// timed-out workers cannot move on anymore, neither
+// can preempted ones unless they get respawned. Workers
+// lost during initialization are respawning until
+// their replacement instance was created.
+const (
+	WorkerPending    WorkerState = "pending"
+	WorkerRegistered WorkerState = "registered"
+	WorkerReady      WorkerState = "ready"
+	WorkerFinished   WorkerState = "finished"
+	WorkerFailed     WorkerState = "failed"
+	WorkerTimedOut   WorkerState = "timed-out"
+	WorkerRespawning WorkerState = "respawning"
+	WorkerPreempted  WorkerState = "preempted"
+)
+
+// expTransitions lists for each experiment
+// state the states it may move on to.
+var expTransitions = map[ExpState][]ExpState{
+	ExpQueued:           {ExpProvisioning, ExpConcluded},
+	ExpProvisioning:     {ExpRunning, ExpAwaitingShutdown, ExpTearingDown, ExpRecovered},
+	ExpRunning:          {ExpAwaitingShutdown, ExpTearingDown, ExpRecovered},
+	ExpAwaitingShutdown: {ExpTearingDown, ExpRecovered},
+	ExpTearingDown:      {ExpConcluded, ExpRecovered},
+	ExpRecovered:        {ExpTearingDown},
+	ExpConcluded:        {},
+}
+
+// workerTransitions lists for each worker
+// state the states it may move on to.
+var workerTransitions = map[WorkerState][]WorkerState{
+	WorkerPending:    {WorkerRegistered, WorkerFailed, WorkerTimedOut, WorkerPreempted},
+	WorkerRegistered: {WorkerReady, WorkerFailed, WorkerTimedOut, WorkerRespawning, WorkerPreempted},
+	WorkerReady:      {WorkerFinished, WorkerFailed, WorkerTimedOut, WorkerPreempted},
+	WorkerFinished:   {},
+	WorkerFailed:     {},
+	WorkerTimedOut:   {},
+	WorkerRespawning: {WorkerPending, WorkerFailed, WorkerTimedOut},
+	WorkerPreempted:  {WorkerRespawning},
+}
+
+// Transition records when an experiment
+// or worker moved from one state to another.
+type Transition struct {
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	At     time.Time `json:"at"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// ExpHook is run after an experiment entered a state.
+type ExpHook func(exp *Exp, tr *Transition)
+
+// WorkerHook is run after a worker entered a state.
+type WorkerHook func(exp *Exp, worker *Worker, tr *Transition)
+
+// CanEnter reports whether an experiment in
+// state from may move on to state to.
+func (from ExpState) CanEnter(to ExpState) bool {
+
+	for _, legal := range expTransitions[from] {
+
+		if legal == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanEnter reports whether a worker in state
+// from may move on to state to. Workers that
+// have no state yet count as pending.
+func (from WorkerState) CanEnter(to WorkerState) bool {
+
+	if from == "" {
+		from = WorkerPending
+	}
+
+	for _, legal := range workerTransitions[from] {
+
+		if legal == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// OnExpState registers a hook to run whenever
+// an experiment entered the supplied state.
+func (op *Operator) OnExpState(state ExpState, hook ExpHook) {
+
+	op.Lock()
+	defer op.Unlock()
+
+	op.ExpHooks[state] = append(op.ExpHooks[state], hook)
+}
+
+// OnWorkerState registers a hook to run whenever
+// a worker entered the supplied state.
+func (op *Operator) OnWorkerState(state WorkerState, hook WorkerHook) {
+
+	op.Lock()
+	defer op.Unlock()
+
+	op.WorkerHooks[state] = append(op.WorkerHooks[state], hook)
+}
+
+// EnterExpState moves an experiment to the supplied
+// state if that transition is legal, persists it, and
+// runs all hooks registered for the new state.
+func (op *Operator) EnterExpState(exp *Exp, state ExpState, reason string) error {
+
+	op.Lock()
+
+	if !exp.State.CanEnter(state) {
+		op.Unlock()
+		return fmt.Errorf("experiment %s cannot move from '%s' to '%s'", exp.ID, exp.State, state)
+	}
+
+	tr := &Transition{
+		From:   string(exp.State),
+		To:     string(state),
+		At:     time.Now(),
+		Reason: reason,
+	}
+
+	exp.State = state
+	exp.Transitions = append(exp.Transitions, tr)
+
+	// Keep flags of earlier API
+	// versions in line with state.
+	exp.Queued = state == ExpQueued
+	exp.Recovered = state == ExpRecovered
+	exp.Concluded = state == ExpConcluded
+
+	hooks := op.ExpHooks[state]
+
+	op.Unlock()
+
+	op.persistExp(exp)
+
+	for i := range hooks {
+		hooks[i](exp, tr)
+	}
+
+	return nil
+}
+
+// EnterWorkerState moves a worker to the supplied
+// state if that transition is legal, persists it,
+// and runs all hooks registered for the new state.
+func (op *Operator) EnterWorkerState(exp *Exp, worker *Worker, state WorkerState, reason string) error {
+
+	op.Lock()
+
+	if !worker.Status.CanEnter(state) {
+		op.Unlock()
+		return fmt.Errorf("worker %s cannot move from '%s' to '%s'", worker.Name, worker.Status, state)
+	}
+
+	from := worker.Status
+	if from == "" {
+		from = WorkerPending
+	}
+
+	tr := &Transition{
+		From:   string(from),
+		To:     string(state),
+		At:     time.Now(),
+		Reason: reason,
+	}
+
+	worker.Status = state
+	worker.Transitions = append(worker.Transitions, tr)
+
+	hooks := op.WorkerHooks[state]
+
+	op.Unlock()
+
+	op.persistWorker(exp, worker)
+
+	for i := range hooks {
+		hooks[i](exp, worker, tr)
+	}
+
+	return nil
+}
+
+// RegisterDefaultHooks installs the hooks that
+// report state changes of experiments to the
+// operator's log and those of workers to the
+// experiment's progress.
+func (op *Operator) RegisterDefaultHooks() {
+
+	for state := range expTransitions {
+
+		op.OnExpState(state, func(exp *Exp, tr *Transition) {
+			fmt.Printf("[EXP] Experiment %s moved from '%s' to '%s'.\n", exp.ID, tr.From, tr.To)
+		})
+	}
+
+	op.OnWorkerState(WorkerRegistered, func(exp *Exp, worker *Worker, tr *Transition) {
+		exp.ProgressChan <- fmt.Sprintf("%s %s at %s marked as registered.", exp.Role(worker), worker.Name, worker.Address)
+	})
+
+	op.OnWorkerState(WorkerReady, func(exp *Exp, worker *Worker, tr *Transition) {
+		exp.ProgressChan <- fmt.Sprintf("%s %s marked as ready.", exp.Role(worker), worker.Name)
+	})
+
+	op.OnWorkerState(WorkerFinished, func(exp *Exp, worker *Worker, tr *Transition) {
+		exp.ProgressChan <- fmt.Sprintf("%s %s marked as finished.", exp.Role(worker), worker.Name)
+	})
+
+	op.OnWorkerState(WorkerFailed, func(exp *Exp, worker *Worker, tr *Transition) {
+		exp.ProgressChan <- fmt.Sprintf("%s %s failed with: %s", exp.Role(worker), worker.Name, tr.Reason)
+	})
+
+	op.OnWorkerState(WorkerTimedOut, func(exp *Exp, worker *Worker, tr *Transition) {
+		exp.ProgressChan <- fmt.Sprintf("%s %s timed out: %s", exp.Role(worker), worker.Name, tr.Reason)
+	})
+
+	op.OnWorkerState(WorkerPreempted, func(exp *Exp, worker *Worker, tr *Transition) {
+		exp.ProgressChan <- fmt.Sprintf("%s %s preempted: %s", exp.Role(worker), worker.Name, tr.Reason)
+	})
+}
+
+// Role returns whether a worker
+// is a server or a client.
+func (exp *Exp) Role(worker *Worker) string {
+
+	_, found := exp.ServersMap[worker.Name]
+	if found {
+		return "Server"
+	}
+
+	return "Client"
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// StoreRecord is one line in the append-only log
+// of the experiment store. Kind is one of 'exp'
+// (experiment snapshot), 'worker' (updated state
+// of one worker), or 'progress' (one new line of
+// experiment progress).
+type StoreRecord struct {
+	Kind   string  `json:"kind"`
+	ExpID  string  `json:"expID"`
+	Exp    *Exp    `json:"exp,omitempty"`
+	Worker *Worker `json:"worker,omitempty"`
+	Line   string  `json:"line,omitempty"`
+}
+
+// Store persists experiments, worker states, and
+// progress lines to an append-only JSON log on disk
+// so that the operator survives restarts.
+type Store struct {
+	sync.Mutex
+	Path string
+	File *os.File
+	Enc  *json.Encoder
+
+	// Number of progress lines in the
+	// log per experiment.
+	Lines map[string]int
+
+	// Whether progress lines were written
+	// since the log was last synced.
+	Unsynced bool
+}
+
+// OpenStore replays the log at path into a map of
+// experiments, compacts the log to one snapshot per
+// experiment, and opens it for appending records.
+func OpenStore(path string) (*Store, map[string]*Exp, error) {
+
+	exps := make(map[string]*Exp)
+
+	logFile, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	if err == nil {
+
+		scanner := bufio.NewScanner(logFile)
+		scanner.Buffer(make([]byte, 0, 65536), (64 * 1024 * 1024))
+
+		for scanner.Scan() {
+
+			rec := &StoreRecord{}
+			err = json.Unmarshal(scanner.Bytes(), rec)
+			if err != nil {
+
+				// A partially written last line stems
+				// from a crash while appending, skip it.
+				fmt.Printf("[STORE] Skipping malformed record in %s: %v\n", path, err)
+				continue
+			}
+
+			applyRecord(exps, rec)
+		}
+
+		logFile.Close()
+
+		err = scanner.Err()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	store := &Store{
+		Path:  path,
+		Lines: make(map[string]int),
+	}
+
+	snapshots := make([]*Exp, 0, len(exps))
+	for expID := range exps {
+		snapshots = append(snapshots, exps[expID])
+		store.Lines[expID] = len(exps[expID].Progress)
+	}
+
+	err = store.rewrite(snapshots)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return store, exps, nil
+}
+
+// rewrite replaces the log with one snapshot per
+// supplied experiment and opens it for appending.
+// Caller has to hold the store lock, if the store
+// is in use.
+func (store *Store) rewrite(snapshots []*Exp) error {
+
+	// Write compacted log to temporary file
+	// and atomically replace the old log.
+	tmpPath := fmt.Sprintf("%s.tmp", store.Path)
+
+	tmpFile, err := os.OpenFile(tmpPath, (os.O_WRONLY | os.O_CREATE | os.O_TRUNC), 0600)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(tmpFile)
+	for i := range snapshots {
+
+		err = enc.Encode(&StoreRecord{
+			Kind:  "exp",
+			ExpID: snapshots[i].ID,
+			Exp:   snapshots[i],
+		})
+		if err != nil {
+			tmpFile.Close()
+			return err
+		}
+	}
+
+	err = tmpFile.Sync()
+	if err != nil {
+		tmpFile.Close()
+		return err
+	}
+	tmpFile.Close()
+
+	err = os.Rename(tmpPath, store.Path)
+	if err != nil {
+		return err
+	}
+
+	// Open compacted log for appending.
+	file, err := os.OpenFile(store.Path, (os.O_WRONLY | os.O_APPEND), 0600)
+	if err != nil {
+		return err
+	}
+
+	if store.File != nil {
+		store.File.Close()
+	}
+
+	store.File = file
+	store.Enc = json.NewEncoder(file)
+	store.Unsynced = false
+
+	return nil
+}
+
+// applyRecord updates the experiments map
+// according to one replayed log record.
+func applyRecord(exps map[string]*Exp, rec *StoreRecord) {
+
+	exp, found := exps[rec.ExpID]
+
+	if rec.Kind == "exp" {
+
+		// Snapshots written at runtime do not
+		// carry progress lines, keep the ones
+		// replayed so far.
+		if found && rec.Exp.Progress == nil {
+			rec.Exp.Progress = exp.Progress
+		}
+
+		if rec.Exp.Progress == nil {
+			rec.Exp.Progress = make([]string, 0, 50)
+		}
+
+		exp = rec.Exp
+		exp.ServersMap = make(map[string]*Worker)
+		exp.ClientsMap = make(map[string]*Worker)
+
+		for i := range exp.Servers {
+			exp.ServersMap[exp.Servers[i].Name] = exp.Servers[i]
+		}
+
+		for i := range exp.Clients {
+			exp.ClientsMap[exp.Clients[i].Name] = exp.Clients[i]
+		}
+
+		exp.indexPairs()
+
+		exps[rec.ExpID] = exp
+
+		return
+	}
+
+	// All other records refer to an
+	// experiment stored before.
+	if !found {
+		return
+	}
+
+	if rec.Kind == "worker" {
+
+		for i := range exp.Servers {
+
+			if exp.Servers[i].Name == rec.Worker.Name {
+				*exp.Servers[i] = *rec.Worker
+			}
+		}
+
+		for i := range exp.Clients {
+
+			if exp.Clients[i].Name == rec.Worker.Name {
+				*exp.Clients[i] = *rec.Worker
+			}
+		}
+
+	} else if rec.Kind == "progress" {
+		exp.Progress = append(exp.Progress, rec.Line)
+	}
+}
+
+// append writes one record to the end of the
+// log and syncs it to stable storage, along with
+// all progress lines written before.
+func (store *Store) append(rec *StoreRecord) error {
+
+	store.Lock()
+	defer store.Unlock()
+
+	err := store.Enc.Encode(rec)
+	if err != nil {
+		return err
+	}
+
+	err = store.File.Sync()
+	if err != nil {
+		return err
+	}
+	store.Unsynced = false
+
+	return nil
+}
+
+// Sync syncs progress lines written since the
+// last synced record to stable storage.
+func (store *Store) Sync() error {
+
+	store.Lock()
+	defer store.Unlock()
+
+	if !store.Unsynced {
+		return nil
+	}
+
+	err := store.File.Sync()
+	if err != nil {
+		return err
+	}
+	store.Unsynced = false
+
+	return nil
+}
+
+// Size returns the current size of the log in bytes.
+func (store *Store) Size() (int64, error) {
+
+	store.Lock()
+	defer store.Unlock()
+
+	info, err := store.File.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// Compact replaces the log with the snapshots of
+// all experiments returned by collect, including
+// their progress lines. The store stays locked
+// while collecting, so that no record written in
+// between gets lost. Progress lines not yet in
+// the log are left to their pending SaveProgress.
+func (store *Store) Compact(collect func() []*Exp) error {
+
+	store.Lock()
+	defer store.Unlock()
+
+	snapshots := collect()
+	for i := range snapshots {
+
+		lines := store.Lines[snapshots[i].ID]
+		if lines < len(snapshots[i].Progress) {
+			snapshots[i].Progress = snapshots[i].Progress[:lines]
+		}
+	}
+
+	return store.rewrite(snapshots)
+}
+
+// snapshot copies the state of a worker so that
+// it can be encoded while handlers keep changing
+// the worker. Caller has to hold the operator lock.
+func (worker *Worker) snapshot() *Worker {
+
+	workerCopy := *worker
+	workerCopy.Transitions = append([]*Transition(nil), worker.Transitions...)
+
+	return &workerCopy
+}
+
+// snapshot copies all experiment details except for
+// its progress lines, including its workers and pairs.
+// Caller has to hold the operator lock.
+func (exp *Exp) snapshot() *Exp {
+
+	servers := make([]*Worker, len(exp.Servers))
+	for i := range exp.Servers {
+		servers[i] = exp.Servers[i].snapshot()
+	}
+
+	clients := make([]*Worker, len(exp.Clients))
+	for i := range exp.Clients {
+		clients[i] = exp.Clients[i].snapshot()
+	}
+
+	pairs := make([]*Pair, len(exp.Pairs))
+	for i := range exp.Pairs {
+		pairCopy := *exp.Pairs[i]
+		pairs[i] = &pairCopy
+	}
+
+	return &Exp{
+		ID:                 exp.ID,
+		Created:            exp.Created,
+		System:             exp.System,
+		State:              exp.State,
+		Transitions:        append([]*Transition(nil), exp.Transitions...),
+		SubmittedBy:        exp.SubmittedBy,
+		Priority:           exp.Priority,
+		Queued:             exp.Queued,
+		QueuedAt:           exp.QueuedAt,
+		Concluded:          exp.Concluded,
+		FailureReason:      exp.FailureReason,
+		Recovered:          exp.Recovered,
+		ResultFolder:       exp.ResultFolder,
+		ClientsPerMachine:  exp.ClientsPerMachine,
+		Pairing:            exp.Pairing,
+		PairingSeed:        exp.PairingSeed,
+		Pairs:              pairs,
+		Cost:               exp.Cost,
+		TeardownPolicy:     exp.TeardownPolicy,
+		ClientTolerance:    exp.ClientTolerance,
+		PreemptibleClients: exp.PreemptibleClients,
+		TeardownTrigger:    exp.TeardownTrigger,
+		Servers:            servers,
+		Clients:            clients,
+	}
+}
+
+// SaveExp persists the supplied snapshot of an
+// experiment, see snapshot.
+func (store *Store) SaveExp(exp *Exp) error {
+
+	return store.append(&StoreRecord{
+		Kind:  "exp",
+		ExpID: exp.ID,
+		Exp:   exp,
+	})
+}
+
+// SaveWorker persists the supplied snapshot
+// of one worker of an experiment.
+func (store *Store) SaveWorker(expID string, worker *Worker) error {
+
+	return store.append(&StoreRecord{
+		Kind:   "worker",
+		ExpID:  expID,
+		Worker: worker,
+	})
+}
+
+// SaveProgress writes one new progress line of an
+// experiment to the log. Progress lines are not synced
+// one by one but with the next record of any other
+// kind or the next call to Sync.
+func (store *Store) SaveProgress(expID string, line string) error {
+
+	store.Lock()
+	defer store.Unlock()
+
+	err := store.Enc.Encode(&StoreRecord{
+		Kind:  "progress",
+		ExpID: expID,
+		Line:  line,
+	})
+	if err != nil {
+		return err
+	}
+
+	store.Lines[expID]++
+	store.Unsynced = true
+
+	return nil
+}
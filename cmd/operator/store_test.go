@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openTestStore opens a store in a fresh
+// temporary directory and returns its path.
+func openTestStore(t *testing.T) (*Store, string, func()) {
+
+	dir, err := ioutil.TempDir("", "acs-store")
+	if err != nil {
+		t.Fatalf("failed creating temporary directory: %v", err)
+	}
+
+	path := filepath.Join(dir, "exps.log")
+
+	store, _, err := OpenStore(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed opening store: %v", err)
+	}
+
+	return store, path, func() {
+		store.File.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStoreProgressReplayed(t *testing.T) {
+
+	store, path, cleanup := openTestStore(t)
+	defer cleanup()
+
+	err := store.SaveExp(&Exp{ID: "exp1", State: ExpRunning})
+	if err != nil {
+		t.Fatalf("failed saving experiment: %v", err)
+	}
+
+	for _, line := range []string{"one", "two", "three"} {
+
+		err = store.SaveProgress("exp1", line)
+		if err != nil {
+			t.Fatalf("failed saving progress: %v", err)
+		}
+	}
+
+	if !store.Unsynced {
+		t.Errorf("expected progress lines to await the next sync")
+	}
+
+	err = store.Sync()
+	if err != nil {
+		t.Fatalf("failed syncing store: %v", err)
+	}
+
+	if store.Unsynced {
+		t.Errorf("expected store to be synced")
+	}
+
+	_, exps, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("failed reopening store: %v", err)
+	}
+
+	if len(exps["exp1"].Progress) != 3 || exps["exp1"].Progress[2] != "three" {
+		t.Errorf("expected three replayed progress lines, got: %v", exps["exp1"].Progress)
+	}
+}
+
+func TestStoreCompact(t *testing.T) {
+
+	store, path, cleanup := openTestStore(t)
+	defer cleanup()
+
+	exp := &Exp{ID: "exp1", State: ExpRunning}
+
+	err := store.SaveExp(exp)
+	if err != nil {
+		t.Fatalf("failed saving experiment: %v", err)
+	}
+
+	for _, line := range []string{"one", "two"} {
+
+		err = store.SaveProgress("exp1", line)
+		if err != nil {
+			t.Fatalf("failed saving progress: %v", err)
+		}
+	}
+
+	// The third line is not yet in the log, its
+	// pending SaveProgress appends it afterwards.
+	err = store.Compact(func() []*Exp {
+		return []*Exp{{ID: "exp1", State: ExpAwaitingShutdown, Progress: []string{"one", "two", "three"}}}
+	})
+	if err != nil {
+		t.Fatalf("failed compacting store: %v", err)
+	}
+
+	err = store.SaveProgress("exp1", "three")
+	if err != nil {
+		t.Fatalf("failed saving progress: %v", err)
+	}
+
+	_, exps, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("failed reopening store: %v", err)
+	}
+
+	if exps["exp1"].State != ExpAwaitingShutdown {
+		t.Errorf("expected state '%s', got '%s'", ExpAwaitingShutdown, exps["exp1"].State)
+	}
+
+	progress := exps["exp1"].Progress
+	if len(progress) != 3 || progress[0] != "one" || progress[2] != "three" {
+		t.Errorf("expected each progress line once, got: %v", progress)
+	}
+}
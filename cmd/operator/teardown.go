@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TeardownMode names how the operator decides
+// to shut down an experiment that reached its end.
+type TeardownMode string
+
+// All teardown modes. Manual waits for confirmation
+// via the public API, on-finish tears down right away,
+// on-finish-after waits the policy's delay first, and
+// on-failure-keep-for-debug tears down right away only
+// if the experiment succeeded and keeps failed ones
+// around for the policy's delay.
+const (
+	TeardownManual        TeardownMode = "manual"
+	TeardownOnFinish      TeardownMode = "on-finish"
+	TeardownOnFinishAfter TeardownMode = "on-finish-after"
+	TeardownOnFailureKeep TeardownMode = "on-failure-keep-for-debug"
+)
+
+// TeardownPolicy is a parsed teardown policy
+// such as 'on-finish-after=10m'.
+type TeardownPolicy struct {
+	Mode  TeardownMode
+	Delay time.Duration
+}
+
+// ParseTeardownPolicy parses a policy of the form
+// MODE or MODE=DURATION, the latter being required
+// for modes that wait before tearing down.
+func ParseTeardownPolicy(policy string) (*TeardownPolicy, error) {
+
+	parts := strings.SplitN(strings.TrimSpace(policy), "=", 2)
+
+	p := &TeardownPolicy{
+		Mode: TeardownMode(parts[0]),
+	}
+
+	switch p.Mode {
+
+	case TeardownManual, TeardownOnFinish:
+
+		if len(parts) > 1 {
+			return nil, fmt.Errorf("teardown policy '%s' does not take a duration", p.Mode)
+		}
+
+	case TeardownOnFinishAfter, TeardownOnFailureKeep:
+
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("teardown policy '%s' requires a duration, e.g., '%s=10m'", p.Mode, p.Mode)
+		}
+
+		delay, err := time.ParseDuration(parts[1])
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf("teardown policy '%s' has invalid duration '%s'", p.Mode, parts[1])
+		}
+		p.Delay = delay
+
+	default:
+		return nil, fmt.Errorf("unknown teardown policy '%s'", policy)
+	}
+
+	return p, nil
+}
+
+// String returns the policy in the
+// form it is parsed from.
+func (p *TeardownPolicy) String() string {
+
+	if p.Mode == TeardownOnFinishAfter || p.Mode == TeardownOnFailureKeep {
+		return fmt.Sprintf("%s=%s", p.Mode, p.Delay)
+	}
+
+	return string(p.Mode)
+}
+
+// Grace returns how long to wait before tearing down
+// an experiment that failed or succeeded. The second
+// value is false if only a confirmation may do so.
+func (p *TeardownPolicy) Grace(failed bool) (time.Duration, bool) {
+
+	switch p.Mode {
+
+	case TeardownOnFinish:
+		return 0, true
+
+	case TeardownOnFinishAfter:
+		return p.Delay, true
+
+	case TeardownOnFailureKeep:
+
+		if failed {
+			return p.Delay, true
+		}
+
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// Failed reports whether an experiment recorded a
+// failure reason or any of its workers failed, timed
+// out, or got preempted.
+func (exp *Exp) Failed() bool {
+
+	if exp.FailureReason != "" {
+		return true
+	}
+
+	for i := range exp.Servers {
+
+		if exp.Servers[i].ended() {
+			return true
+		}
+	}
+
+	for i := range exp.Clients {
+
+		if exp.Clients[i].ended() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SignalTerminate asks the runner conducting an
+// experiment to tear it down. The cause is recorded
+// as the teardown trigger, an empty one stands for
+// a request via the public API. The first cause
+// of several pending signals wins.
+func (op *Operator) SignalTerminate(exp *Exp, cause string) {
+
+	op.Lock()
+	if exp.TerminateBy == "" {
+		exp.TerminateBy = cause
+	}
+	op.Unlock()
+
+	// A signal still pending
+	// already covers this one.
+	select {
+	case exp.TerminateChan <- struct{}{}:
+	default:
+	}
+}
+
+// terminateTrigger returns the cause passed to
+// SignalTerminate, or fallback for the public API.
+func (op *Operator) terminateTrigger(exp *Exp, fallback string) string {
+
+	op.Lock()
+	defer op.Unlock()
+
+	if exp.TerminateBy != "" {
+		return exp.TerminateBy
+	}
+
+	return fallback
+}
+
+// AwaitTeardown blocks an experiment that reached its
+// end until its teardown policy or a confirmation via
+// the public API or the reaper shuts it down, whichever
+// comes first.
+// It returns what triggered the teardown.
+func (op *Operator) AwaitTeardown(exp *Exp) string {
+
+	policy, err := ParseTeardownPolicy(exp.TeardownPolicy)
+	if err != nil {
+		exp.ProgressChan <- fmt.Sprintf("Falling back to manual teardown of experiment %s: %v", exp.ID, err)
+		policy = &TeardownPolicy{Mode: TeardownManual}
+	}
+
+	op.Lock()
+	failed := exp.Failed()
+	op.Unlock()
+
+	trigger := "shutdown confirmation"
+
+	grace, auto := policy.Grace(failed)
+	if !auto {
+
+		exp.ProgressChan <- fmt.Sprintf("Experiment %s reached end, awaiting shutdown confirmation.", exp.ID)
+
+		// Wait for explicit shutdown confirmation.
+		<-exp.TerminateChan
+
+		trigger = op.terminateTrigger(exp, trigger)
+		exp.ProgressChan <- fmt.Sprintf("Teardown of experiment %s triggered by %s.", exp.ID, trigger)
+
+	} else {
+
+		exp.ProgressChan <- fmt.Sprintf("Experiment %s reached end, teardown policy '%s' shuts it down in %s unless confirmed earlier.",
+			exp.ID, policy, grace)
+
+		timer := time.NewTimer(grace)
+
+		select {
+
+		case <-exp.TerminateChan:
+			timer.Stop()
+			trigger = op.terminateTrigger(exp, trigger)
+			exp.ProgressChan <- fmt.Sprintf("Teardown of experiment %s triggered by %s.", exp.ID, trigger)
+
+		case <-timer.C:
+			trigger = fmt.Sprintf("policy '%s'", policy)
+			exp.ProgressChan <- fmt.Sprintf("Teardown policy '%s' shuts down experiment %s.", policy, exp.ID)
+		}
+	}
+
+	return trigger
+}
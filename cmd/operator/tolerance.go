@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FailureTolerance bounds how many client workers
+// of an experiment may fail, time out, or get preempted
+// before the experiment is ended, either as absolute
+// count or as percentage of all client workers.
+type FailureTolerance struct {
+	Count   int
+	Percent float64
+}
+
+// FailedClients is the record of all failed client
+// workers the operator places into the result folder
+// of an experiment. Analyses exclude the logical
+// clients run on them as well as their partners.
+type FailedClients struct {
+	Workers         []*FailedWorker `json:"workers"`
+	ExcludedClients []string        `json:"excludedClients"`
+}
+
+// FailedWorker describes one client
+// worker that failed or timed out.
+type FailedWorker struct {
+	Name   string      `json:"name"`
+	Zone   string      `json:"zone"`
+	Status WorkerState `json:"status"`
+	Reason string      `json:"reason"`
+}
+
+// ParseFailureTolerance parses a tolerance of either
+// the form N (at most N client workers) or X% (at most
+// X percent of client workers, rounded down). An empty
+// tolerance tolerates no failures.
+func ParseFailureTolerance(tolerance string) (*FailureTolerance, error) {
+
+	tolerance = strings.TrimSpace(tolerance)
+	t := &FailureTolerance{}
+
+	if tolerance == "" {
+		return t, nil
+	}
+
+	if strings.HasSuffix(tolerance, "%") {
+
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(tolerance, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("client failure tolerance '%s' needs to be a percentage between 0%% and 100%%", tolerance)
+		}
+		t.Percent = percent
+
+		return t, nil
+	}
+
+	count, err := strconv.Atoi(tolerance)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("client failure tolerance '%s' needs to be a non-negative count or a percentage", tolerance)
+	}
+	t.Count = count
+
+	return t, nil
+}
+
+// String returns the tolerance in the
+// form it is parsed from.
+func (t *FailureTolerance) String() string {
+
+	if t.Percent > 0 {
+		return fmt.Sprintf("%s%%", strconv.FormatFloat(t.Percent, 'f', -1, 64))
+	}
+
+	return strconv.Itoa(t.Count)
+}
+
+// Allowed returns how many out of
+// total client workers may fail.
+func (t *FailureTolerance) Allowed(total int) int {
+
+	if t.Percent > 0 {
+		return int(float64(total) * t.Percent / 100)
+	}
+
+	return t.Count
+}
+
+// ended reports whether a worker failed,
+// timed out, or got preempted.
+func (worker *Worker) ended() bool {
+
+	return worker.Status == WorkerFailed || worker.Status == WorkerTimedOut || worker.Status == WorkerPreempted
+}
+
+// BeyondTolerance returns why the failures among the
+// workers of an experiment end it, that is, if any
+// server or more client workers than tolerated failed
+// or timed out. It returns an empty string otherwise.
+func (op *Operator) BeyondTolerance(exp *Exp) string {
+
+	op.Lock()
+	defer op.Unlock()
+
+	for i := range exp.Servers {
+
+		if exp.Servers[i].ended() {
+			return fmt.Sprintf("server %s %s", exp.Servers[i].Name, exp.Servers[i].Status)
+		}
+	}
+
+	failed := make([]string, 0, len(exp.Clients))
+	for i := range exp.Clients {
+
+		if exp.Clients[i].ended() {
+			failed = append(failed, exp.Clients[i].Name)
+		}
+	}
+
+	tolerance, err := ParseFailureTolerance(exp.ClientTolerance)
+	if err != nil {
+		tolerance = &FailureTolerance{}
+	}
+
+	allowed := tolerance.Allowed(len(exp.Clients))
+	if len(failed) > allowed {
+		return fmt.Sprintf("%d of %d clients failed, timed out, or got preempted, tolerating %d: %s",
+			len(failed), len(exp.Clients), allowed, strings.Join(failed, ", "))
+	}
+
+	return ""
+}
+
+// FailedClients collects all client workers of an
+// experiment that failed or timed out, together with
+// the logical clients whose measurements are affected.
+func (op *Operator) FailedClients(exp *Exp) *FailedClients {
+
+	op.Lock()
+	defer op.Unlock()
+
+	failed := &FailedClients{
+		Workers:         make([]*FailedWorker, 0),
+		ExcludedClients: make([]string, 0),
+	}
+
+	machines := make(map[string]bool)
+
+	for i := range exp.Clients {
+
+		worker := exp.Clients[i]
+		if !worker.ended() {
+			continue
+		}
+
+		reason := ""
+		if len(worker.Transitions) > 0 {
+			reason = worker.Transitions[(len(worker.Transitions) - 1)].Reason
+		}
+
+		failed.Workers = append(failed.Workers, &FailedWorker{
+			Name:   worker.Name,
+			Zone:   worker.Zone,
+			Status: worker.Status,
+			Reason: reason,
+		})
+		machines[worker.Name] = true
+	}
+
+	// Logical clients on failed machines measured
+	// nothing, and neither did their partners.
+	for i := range exp.Pairs {
+
+		if machines[exp.Pairs[i].ClientMachine] || machines[exp.Pairs[i].PartnerMachine] {
+			failed.ExcludedClients = append(failed.ExcludedClients, exp.Pairs[i].Client)
+		}
+	}
+
+	return failed
+}
+
+// UploadFailedClients places the record of all failed
+// client workers as 'failed-clients.json' into the
+// result folder of the experiment.
+func (exp *Exp) UploadFailedClients(bucketDir string, failed *FailedClients) error {
+
+	failedJSON, err := json.MarshalIndent(failed, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return exp.upload(bucketDir, "failed-clients.json", failedJSON)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Event types the operator
+// posts to webhooks.
+const (
+	EventQueued       = "queued"
+	EventServersReady = "servers-ready"
+	EventClientsReady = "clients-ready"
+	EventWorkerFailed = "worker-failed"
+	EventFinished     = "finished"
+	EventTornDown     = "torn-down"
+)
+
+// SignatureHeader carries the hex-encoded HMAC-SHA256
+// of the body of each webhook request, keyed with
+// the secret shared with the receiver.
+const SignatureHeader = "X-ACS-Signature"
+
+// Event is the JSON payload posted to all webhooks
+// whenever an experiment reached a milestone.
+type Event struct {
+	Seq          uint64    `json:"seq"`
+	Type         string    `json:"type"`
+	At           time.Time `json:"at"`
+	ExpID        string    `json:"expID"`
+	System       string    `json:"system"`
+	ResultFolder string    `json:"resultFolder"`
+	State        string    `json:"state"`
+	Worker       string    `json:"worker,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+}
+
+// Notifier delivers events to a set of webhook
+// URLs in the background, retrying failed
+// deliveries a few times.
+type Notifier struct {
+	URLs    []string
+	Secret  []byte
+	Client  *http.Client
+	Retries int
+	seq     uint64
+}
+
+// NewNotifier returns a notifier for supplied
+// webhook URLs that signs with secret.
+func NewNotifier(urls []string, secret string) *Notifier {
+
+	return &Notifier{
+		URLs:    urls,
+		Secret:  []byte(secret),
+		Client:  &http.Client{Timeout: (10 * time.Second)},
+		Retries: 3,
+	}
+}
+
+// Sign returns the hex-encoded HMAC-SHA256
+// of body keyed with secret.
+func Sign(secret []byte, body []byte) string {
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify numbers the event and posts it
+// to all webhooks without blocking.
+func (n *Notifier) Notify(event *Event) {
+
+	event.Seq = atomic.AddUint64(&n.seq, 1)
+	event.At = time.Now()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		fmt.Printf("[WEBHOOK] Failed encoding event %s of experiment %s: %v\n", event.Type, event.ExpID, err)
+		return
+	}
+
+	for i := range n.URLs {
+		go n.deliver(n.URLs[i], body)
+	}
+}
+
+// deliver posts the signed body to one webhook
+// and retries with growing pauses if the
+// receiver cannot be reached or rejects it.
+func (n *Notifier) deliver(url string, body []byte) {
+
+	var err error
+
+	for try := 0; try <= n.Retries; try++ {
+
+		if try > 0 {
+			time.Sleep(time.Duration(try) * time.Second)
+		}
+
+		err = n.post(url, body)
+		if err == nil {
+			return
+		}
+	}
+
+	fmt.Printf("[WEBHOOK] Giving up delivering event to %s: %v\n", url, err)
+}
+
+// post sends one signed webhook request.
+func (n *Notifier) post(url string, body []byte) error {
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(http.CanonicalHeaderKey("content-type"), "application/json")
+	req.Header.Set(SignatureHeader, fmt.Sprintf("sha256=%s", Sign(n.Secret, body)))
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the
+	// connection can be reused.
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// notify posts an event about an experiment to all
+// webhooks, if any are configured.
+func (op *Operator) notify(exp *Exp, eventType string, worker string, reason string) {
+
+	if op.Notifier == nil {
+		return
+	}
+
+	op.Lock()
+	event := &Event{
+		Type:         eventType,
+		ExpID:        exp.ID,
+		System:       exp.System,
+		ResultFolder: exp.ResultFolder,
+		State:        string(exp.State),
+		Worker:       worker,
+		Reason:       reason,
+	}
+	op.Unlock()
+
+	op.Notifier.Notify(event)
+}
+
+// RegisterWebhookHooks installs the hooks that
+// post failed workers as well as finished and
+// torn down experiments to all webhooks. The
+// other events are posted where the operator
+// reaches them.
+func (op *Operator) RegisterWebhookHooks() {
+
+	workerFailed := func(exp *Exp, worker *Worker, tr *Transition) {
+		op.notify(exp, EventWorkerFailed, worker.Name, fmt.Sprintf("%s: %s", tr.To, tr.Reason))
+	}
+
+	op.OnWorkerState(WorkerFailed, workerFailed)
+	op.OnWorkerState(WorkerTimedOut, workerFailed)
+	op.OnWorkerState(WorkerPreempted, workerFailed)
+
+	op.OnExpState(ExpAwaitingShutdown, func(exp *Exp, tr *Transition) {
+		op.notify(exp, EventFinished, "", exp.FailureReason)
+	})
+
+	op.OnExpState(ExpConcluded, func(exp *Exp, tr *Transition) {
+		op.notify(exp, EventTornDown, "", exp.FailureReason)
+	})
+}
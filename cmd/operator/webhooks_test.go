@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// delivery is one request received
+// by the fake webhook receiver.
+type delivery struct {
+	Signature string
+	Body      []byte
+}
+
+// newFakeReceiver starts a webhook receiver that
+// accepts requests signed with secret and hands
+// every request it receives to the returned channel.
+func newFakeReceiver(secret string) (*httptest.Server, chan *delivery) {
+
+	received := make(chan *delivery, 10)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		header := req.Header.Get("X-ACS-Signature")
+		received <- &delivery{Signature: header, Body: body}
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+
+		sig, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+		if err != nil || !strings.HasPrefix(header, "sha256=") || !hmac.Equal(sig, mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	return srv, received
+}
+
+func TestNotifySignsBody(t *testing.T) {
+
+	srv, received := newFakeReceiver("shared-secret")
+	defer srv.Close()
+
+	n := NewNotifier([]string{srv.URL}, "shared-secret")
+	n.Notify(&Event{Type: EventQueued, ExpID: "exp1", System: "zeno", State: string(ExpQueued)})
+
+	var d *delivery
+	select {
+	case d = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected event to be delivered")
+	}
+
+	mac := hmac.New(sha256.New, []byte("shared-secret"))
+	mac.Write(d.Body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if d.Signature != expected {
+		t.Errorf("expected signature header '%s', got '%s'", expected, d.Signature)
+	}
+
+	event := &Event{}
+	err := json.Unmarshal(d.Body, event)
+	if err != nil {
+		t.Fatalf("failed decoding delivered event: %v", err)
+	}
+
+	if event.Seq != 1 || event.Type != EventQueued || event.ExpID != "exp1" {
+		t.Errorf("expected first queued event of exp1, got: %+v", event)
+	}
+}
+
+func TestPostSignature(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		secret string
+		valid  bool
+	}{
+		{"matching secret", "shared-secret", true},
+		{"wrong secret", "other-secret", false},
+		{"empty secret", "", false},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			srv, received := newFakeReceiver("shared-secret")
+			defer srv.Close()
+
+			n := NewNotifier([]string{srv.URL}, test.secret)
+
+			err := n.post(srv.URL, []byte(`{"seq":1,"type":"queued"}`))
+			if test.valid && err != nil {
+				t.Errorf("expected receiver to accept signature, got: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Errorf("expected receiver to reject signature")
+			}
+
+			d := <-received
+			if d.Signature != ("sha256=" + Sign([]byte(test.secret), d.Body)) {
+				t.Errorf("expected signature of body with secret '%s', got '%s'", test.secret, d.Signature)
+			}
+		})
+	}
+}
@@ -7,9 +7,12 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/numbleroot/acs-test-bed/cmd/operator/metrics"
 )
 
 // Endpoint bundles all information sent by a
@@ -38,8 +41,17 @@ type PKI struct {
 	MuNodes          *sync.RWMutex
 	Nodes            map[string]*Endpoint
 	EvalCtrlChan     chan struct{}
+	Epoch            int32
 }
 
+// Metrics the PKI exports via the operator.
+var (
+	registrationsTotal = metrics.NewCounterVec("acs_zeno_pki_registrations_total",
+		"Accepted registrations at the zeno PKI per epoch and category.", "epoch", "category")
+	broadcastSeconds = metrics.NewHistogramVec("acs_zeno_pki_broadcast_duration_seconds",
+		"Time the zeno PKI took to broadcast data to all nodes.", metrics.DurationBuckets, "data")
+)
+
 // SendDataToNode accepts all arguments required
 // to securely contact one node in isolation and
 // transmit supplied data.
@@ -94,6 +106,7 @@ func SendDataToNode(wg *sync.WaitGroup, node *Endpoint, data string) {
 // signal to all nodes the PKI is aware of.
 func (pki *PKI) BroadcastData(dataToSend string) {
 
+	start := time.Now()
 	wg := &sync.WaitGroup{}
 
 	pki.MuNodes.RLock()
@@ -150,6 +163,8 @@ func (pki *PKI) BroadcastData(dataToSend string) {
 	// to finish before returning.
 	wg.Wait()
 
+	broadcastSeconds.Observe(time.Since(start).Seconds(), dataToSend)
+
 	fmt.Printf("[ZENO PKI] Broadcast finished\n\n")
 }
 
@@ -189,6 +204,7 @@ func (pki *PKI) HandleReq(connWrite net.Conn) {
 			// mix intention registrations, do it.
 			pki.Nodes[reg.Name] = &reg
 			success = 0
+			registrationsTotal.Inc(strconv.Itoa(int(atomic.LoadInt32(&pki.Epoch))), "mix")
 
 		} else {
 			success = 2
@@ -202,6 +218,7 @@ func (pki *PKI) HandleReq(connWrite net.Conn) {
 			// client registrations, do it.
 			pki.Nodes[reg.Name] = &reg
 			success = 0
+			registrationsTotal.Inc(strconv.Itoa(int(atomic.LoadInt32(&pki.Epoch))), "client")
 
 		} else {
 			success = 2
@@ -266,6 +283,10 @@ func (pki *PKI) Run(cert string, key string) {
 
 	fmt.Printf("[ZENO PKI] Listening on %s for PKI requests...\n", pki.LisAddr)
 
+	// Registrations arriving ahead of the start
+	// signal already belong to the first epoch.
+	atomic.StoreInt32(&pki.Epoch, 1)
+
 	// Handle incoming mix intentions and
 	// client registrations.
 	go pki.AcceptRegistrations()
@@ -334,5 +355,8 @@ func (pki *PKI) Run(cert string, key string) {
 		pki.AcceptClientRegs = 0
 		pki.MuNodes = &sync.RWMutex{}
 		pki.Nodes = make(map[string]*Endpoint)
+
+		// Registrations from now on are for the next epoch.
+		atomic.AddInt32(&pki.Epoch, 1)
 	}
 }
@@ -14,19 +14,57 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Exp contains all experiment information
 // the operator uses to manage experiments.
 type Exp struct {
-	ID           string   `json:"id"`
-	Created      string   `json:"created"`
-	System       string   `json:"system"`
-	Concluded    bool     `json:"concluded"`
-	ResultFolder string   `json:"resultFolder"`
-	Progress     []string `json:"progress"`
-	Servers      []Worker `json:"servers"`
-	Clients      []Worker `json:"clients"`
+	ID                 string        `json:"id"`
+	Created            string        `json:"created"`
+	System             string        `json:"system"`
+	Priority           int           `json:"priority"`
+	QueuePosition      int           `json:"queuePosition"`
+	Concluded          bool          `json:"concluded"`
+	FailureReason      string        `json:"failureReason"`
+	ResultFolder       string        `json:"resultFolder"`
+	ClientsPerMachine  int           `json:"clientsPerMachine"`
+	Pairing            string        `json:"pairing"`
+	PairingSeed        int64         `json:"pairingSeed"`
+	ExpectedDuration   string        `json:"expectedDuration,omitempty"`
+	TeardownPolicy     string        `json:"teardownPolicy,omitempty"`
+	ClientTolerance    string        `json:"clientTolerance,omitempty"`
+	PreemptibleClients bool          `json:"preemptibleClients"`
+	TeardownTrigger    string        `json:"teardownTrigger,omitempty"`
+	Cost               *CostEstimate `json:"cost,omitempty"`
+	Progress           []string      `json:"progress"`
+	Servers            []Worker      `json:"servers"`
+	Clients            []Worker      `json:"clients"`
+}
+
+// CostEstimate is the operator's estimate of
+// what running the instances of an experiment
+// costs per hour and for its expected duration.
+type CostEstimate struct {
+	Currency   string  `json:"currency"`
+	PerHour    float64 `json:"perHour"`
+	Hours      float64 `json:"hours"`
+	PerRun     float64 `json:"perRun"`
+	Budget     float64 `json:"budget,omitempty"`
+	OverBudget bool    `json:"overBudget,omitempty"`
+}
+
+// PrettyPrint writes the cost
+// estimate human-readable to STDOUT.
+func (cost *CostEstimate) PrettyPrint() {
+
+	fmt.Printf("  Estimated cost: %.2f %s per hour, %.2f %s for %.1f hours", cost.PerHour, cost.Currency, cost.PerRun, cost.Currency, cost.Hours)
+	if cost.OverBudget {
+		fmt.Printf(" (EXCEEDS budget %.2f %s, operator would reject it)", cost.Budget, cost.Currency)
+	} else if cost.Budget > 0 {
+		fmt.Printf(" (budget %.2f %s)", cost.Budget, cost.Currency)
+	}
+	fmt.Printf("\n")
 }
 
 // ExpFile represents the in-file representation
@@ -35,6 +73,7 @@ type ExpFile struct {
 	System                       string          `json:"system"`
 	ServerZoneNetTroublesIfUsed  string          `json:"serverZoneNetTroublesIfUsed"`
 	ClientZonesNetTroublesIfUsed map[string]bool `json:"clientZonesNetTroublesIfUsed"`
+	ClientsPerMachine            int             `json:"clientsPerMachine"`
 	Servers                      []Worker        `json:"servers"`
 	Clients                      []Worker        `json:"clients"`
 }
@@ -59,19 +98,32 @@ type Worker struct {
 }
 
 // PrettyPrint writes the experiment
-// human-readable to STDOUT.
+// human-readable to STDOUT. Progress lines
+// are printed by the progress stream instead.
 func (exp *Exp) PrettyPrint() {
 
 	fmt.Printf("---\n")
 	fmt.Printf("Experiment for system '%s' with ID '%s', created at '%s':\n", exp.System, exp.ID, exp.Created)
+	fmt.Printf("  Priority: %d\n", exp.Priority)
+	if exp.QueuePosition > 0 {
+		fmt.Printf("  Queued at position: %d\n", exp.QueuePosition)
+	}
 	fmt.Printf("  Concluded? '%v'\n", exp.Concluded)
+	if exp.FailureReason != "" {
+		fmt.Printf("  Failed: %s\n", exp.FailureReason)
+	}
 	fmt.Printf("  ResultFolder: '%s'\n", exp.ResultFolder)
 	fmt.Printf("  Servers: %d\n", len(exp.Servers))
-	fmt.Printf("  Clients: %d\n", len(exp.Clients))
-
-	fmt.Printf("\nPROGRESS:\n")
-	for i := range exp.Progress {
-		fmt.Printf("%s\n", exp.Progress[i])
+	fmt.Printf("  Clients: %d (%d per machine)\n", len(exp.Clients), exp.ClientsPerMachine)
+	fmt.Printf("  Pairing: '%s' (seed %d)\n", exp.Pairing, exp.PairingSeed)
+	fmt.Printf("  Teardown policy: '%s'\n", exp.TeardownPolicy)
+	fmt.Printf("  Tolerated client failures: %s\n", exp.ClientTolerance)
+	fmt.Printf("  Preemptible clients? '%v'\n", exp.PreemptibleClients)
+	if exp.TeardownTrigger != "" {
+		fmt.Printf("  Teardown triggered by: %s\n", exp.TeardownTrigger)
+	}
+	if exp.Cost != nil {
+		exp.Cost.PrettyPrint()
 	}
 
 	fmt.Printf("\nSERVERS:\n")
@@ -90,12 +142,32 @@ func (exp *Exp) PrettyPrint() {
 // CustomizedExp prepares a new experiment
 // ready to be sent to the operator that is
 // customized to the specified flags of this run.
-func CustomizedExp(expFile *ExpFile, gcsResultsPath string, applyHighDelay bool, applyHighLoss bool, killZenoMixesInRound int) *Exp {
+func CustomizedExp(expFile *ExpFile, gcsResultsPath string, priority int, clientsPerMachine int, pairing string, pairingSeed int64, expectedDuration time.Duration, teardownPolicy string, clientTolerance string, preemptibleClients bool, applyHighDelay bool, applyHighLoss bool, killZenoMixesInRound int) *Exp {
 
 	exp := &Exp{}
 
 	exp.System = expFile.System
+	exp.Priority = priority
 	exp.ResultFolder = gcsResultsPath
+
+	exp.Pairing = pairing
+	exp.PairingSeed = pairingSeed
+
+	if expectedDuration > 0 {
+		exp.ExpectedDuration = expectedDuration.String()
+	}
+
+	exp.TeardownPolicy = teardownPolicy
+	exp.ClientTolerance = clientTolerance
+	exp.PreemptibleClients = preemptibleClients
+
+	// Clients per machine specified on the command
+	// line take precedence over the configuration.
+	exp.ClientsPerMachine = expFile.ClientsPerMachine
+	if clientsPerMachine > 0 {
+		exp.ClientsPerMachine = clientsPerMachine
+	}
+
 	exp.Servers = make([]Worker, len(expFile.Servers))
 	exp.Clients = make([]Worker, len(expFile.Clients))
 
@@ -175,8 +247,19 @@ func main() {
 	systemFlag := flag.String("system", "", "Specify which ACS to evaluate: 'zeno', 'vuvuzela', 'pung'.")
 	configsPathFlag := flag.String("configsPath", "./gcloud-configs/", "Specify the file system location of the configurations folder for the compute instances.")
 	operatorAddrFlag := flag.String("operatorAddr", "127.0.0.1:443", "Supply the address at which the TLS API of the operator is reachable.")
+	apiTokenFlag := flag.String("apiToken", "", "Supply the bearer token to authenticate at the operator's public API with (defaults to environment variable ACS_EVAL_API_TOKEN).")
 	certFileFlag := flag.String("certFile", "./operator-cert.pem", "Specify the file system location of the self-signed TLS certificate of the operator.")
 	gcsResultsPathFlag := flag.String("gcsResultsPath", "", "Specify the GCS file system location to store the result files.")
+	priorityFlag := flag.Int("priority", 0, "Set the priority of this experiment in the operator's queue. Higher priorities are conducted first.")
+	clientsPerMachineFlag := flag.Int("clientsPerMachine", 0, "Set the number of conversing clients to run on each client machine (defaults to the value in the configuration, else ten).")
+	pairingFlag := flag.String("pairing", "same-machine", "Set how clients are paired up: 'same-machine', 'cross-machine', 'cross-zone', or 'cross-continent'.")
+	pairingSeedFlag := flag.Int64("pairingSeed", 0, "Fix the seed of random pairings to reproduce them (0 lets the operator pick one).")
+	expectedDurationFlag := flag.Duration("expectedDuration", 0, "Set how long this experiment is expected to run, for estimating its cost (0 lets the operator assume its default).")
+	teardownPolicyFlag := flag.String("teardownPolicy", "", "Set when the operator shuts down this experiment after it reached its end: 'manual' (type 't'), 'on-finish', 'on-finish-after=DURATION', or 'on-failure-keep-for-debug=DURATION' (empty lets the operator apply its default).")
+	clientToleranceFlag := flag.String("clientTolerance", "", "Set how many client machines may fail or time out without ending this experiment, either as count (e.g., '3') or as percentage (e.g., '5%').")
+	preemptibleClientsFlag := flag.Bool("preemptibleClients", false, "Append this flag to run all client machines on cheaper preemptible instances. Preempted clients are replaced if the operator allows respawns and they were not ready yet, else count against '-clientTolerance'.")
+	dryRunFlag := flag.Bool("dryRun", false, "Append this flag to only print the operator's cost estimate for this experiment instead of submitting it.")
+	planFlag := flag.Bool("plan", false, "Append this flag to only print the operator's fully resolved plan for this experiment as JSON instead of submitting it (fix '-pairingSeed' to diff plans).")
 	applyHighDelayFlag := flag.Bool("applyHighDelay", false, "Append this flag to emulate high packet delay and medium packet loss in select zones (both for combined effect).")
 	applyHighLossFlag := flag.Bool("applyHighLoss", false, "Append this flag to emulate medium packet delay and high packet loss in select zones (both for combined effect).")
 	killZenoMixesInRoundFlag := flag.Int("killZenoMixesInRound", -1, "If specific mix nodes in all but one zeno cascade are supposed to crash, specify the round in which that shall happen.")
@@ -188,6 +271,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	apiToken := *apiTokenFlag
+	if apiToken == "" {
+		apiToken = os.Getenv("ACS_EVAL_API_TOKEN")
+	}
+
+	if apiToken == "" {
+		fmt.Printf("Missing API token, please provide it via flag '-apiToken' or environment variable ACS_EVAL_API_TOKEN.\n")
+		os.Exit(1)
+	}
+
 	system := strings.ToLower(*systemFlag)
 	gcsResultsPath := *gcsResultsPathFlag
 	killZenoMixesInRound := *killZenoMixesInRoundFlag
@@ -282,7 +375,7 @@ func main() {
 
 	// Manipulate experiment data according
 	// to supplied flags.
-	reqExp := CustomizedExp(reqExpFile, gcsResultsPath, *applyHighDelayFlag, *applyHighLossFlag, *killZenoMixesInRoundFlag)
+	reqExp := CustomizedExp(reqExpFile, gcsResultsPath, *priorityFlag, *clientsPerMachineFlag, *pairingFlag, *pairingSeedFlag, *expectedDurationFlag, *teardownPolicyFlag, *clientToleranceFlag, *preemptibleClientsFlag, *applyHighDelayFlag, *applyHighLossFlag, *killZenoMixesInRoundFlag)
 
 	// Prepare buffer of JSON payload to be
 	// attached to the HTTPS request.
@@ -293,6 +386,88 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *planFlag {
+
+		// Only ask the operator what conducting
+		// the experiment would do.
+		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("https://%s/public/experiments/plan", *operatorAddrFlag), reqBodyBuf)
+		if err != nil {
+			fmt.Printf("Failed creating HTTPS API request for plan: %v\n", err)
+			os.Exit(1)
+		}
+		req.Header.Set(http.CanonicalHeaderKey("Authorization"), fmt.Sprintf("Bearer %s", apiToken))
+		req.Header.Set(http.CanonicalHeaderKey("Content-Type"), "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			fmt.Printf("Failed sending HTTPS API request for plan: %v\n", err)
+			os.Exit(1)
+		}
+		defer resp.Body.Close()
+
+		planRaw, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			fmt.Printf("Failed reading plan: %v\n", err)
+			os.Exit(1)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("Operator rejected request for plan (status %d): %s\n", resp.StatusCode, planRaw)
+			os.Exit(1)
+		}
+
+		// Print the plan in a stable format
+		// suitable for diffing.
+		plan := new(bytes.Buffer)
+		err = json.Indent(plan, planRaw, "", "  ")
+		if err != nil {
+			fmt.Printf("Failed formatting plan: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("%s\n", plan.Bytes())
+
+		return
+	}
+
+	if *dryRunFlag {
+
+		// Only ask the operator what the
+		// experiment would cost.
+		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("https://%s/public/experiments/new?dryRun=true", *operatorAddrFlag), reqBodyBuf)
+		if err != nil {
+			fmt.Printf("Failed creating HTTPS API request for cost estimate: %v\n", err)
+			os.Exit(1)
+		}
+		req.Header.Set(http.CanonicalHeaderKey("Authorization"), fmt.Sprintf("Bearer %s", apiToken))
+		req.Header.Set(http.CanonicalHeaderKey("Content-Type"), "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			fmt.Printf("Failed sending HTTPS API request for cost estimate: %v\n", err)
+			os.Exit(1)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			msg, _ := ioutil.ReadAll(resp.Body)
+			fmt.Printf("Operator rejected request for cost estimate (status %d): %s\n", resp.StatusCode, msg)
+			os.Exit(1)
+		}
+
+		cost := &CostEstimate{}
+		err = json.NewDecoder(resp.Body).Decode(cost)
+		if err != nil {
+			fmt.Printf("Failed decoding cost estimate to JSON: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Dry run of experiment for system '%s' with %d servers and %d clients:\n", reqExp.System, len(reqExp.Servers), len(reqExp.Clients))
+		cost.PrettyPrint()
+
+		return
+	}
+
 	// Read OAuth token from gcloud.
 	outRaw, err := exec.Command("/opt/google-cloud-sdk/bin/gcloud", "auth", "print-access-token").CombinedOutput()
 	if err != nil {
@@ -308,7 +483,7 @@ func main() {
 		fmt.Printf("Failed creating HTTPS API request for new experiment: %v\n", err)
 		os.Exit(1)
 	}
-	req.Header.Set(http.CanonicalHeaderKey("Authorization"), "UniverseOfLoopholes")
+	req.Header.Set(http.CanonicalHeaderKey("Authorization"), fmt.Sprintf("Bearer %s", apiToken))
 	req.Header.Set(http.CanonicalHeaderKey("AccessToken"), accessToken)
 	req.Header.Set(http.CanonicalHeaderKey("Content-Type"), "application/json")
 
@@ -319,6 +494,17 @@ func main() {
 		os.Exit(1)
 	}
 
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		fmt.Printf("Operator rejected API token for new experiment (status %d).\n", resp.StatusCode)
+		os.Exit(1)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Operator rejected new experiment (status %d): %s\n", resp.StatusCode, msg)
+		os.Exit(1)
+	}
+
 	// Read the response.
 	respExp := &Exp{}
 	err = json.NewDecoder(resp.Body).Decode(respExp)
@@ -331,19 +517,55 @@ func main() {
 	fmt.Printf("Operator responded to request for new experiment with:\n")
 	respExp.PrettyPrint()
 
+	// Print progress of experiment live. The stream
+	// ends once the operator concluded the experiment,
+	// e.g., because its teardown policy triggered.
+	streamEnded := make(chan struct{})
+	go func() {
+		if TailProgress(client, *operatorAddrFlag, apiToken, respExp.ID) {
+			close(streamEnded)
+		}
+	}()
+
 	// Loop over user input. Await either status
 	// request or experiment termination input.
 
 	fmt.Printf("Type 's' for 'status' or 't' for 'terminate' and press ENTER.\n")
-	fmt.Printf("This either requests the current status of the experiment or confirms shutdown and deletion of all experiment resources... ")
+	fmt.Printf("This either requests the current status of all workers of the experiment or confirms shutdown and deletion of all experiment resources... ")
 
-	input := ""
-	stdIn := bufio.NewReader(os.Stdin)
+	// Read user input in the background, so that
+	// the end of the progress stream ends the loop.
+	inputChan := make(chan string)
+	go func() {
 
-	input, _ = stdIn.ReadString('\n')
-	for strings.TrimSpace(input) != "t" {
+		stdIn := bufio.NewReader(os.Stdin)
+		for {
+
+			input, err := stdIn.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			inputChan <- strings.TrimSpace(input)
+		}
+	}()
+
+	concluded := false
+	awaitInput := func() string {
+
+		select {
+		case input := <-inputChan:
+			return input
+		case <-streamEnded:
+			concluded = true
+			return ""
+		}
+	}
 
-		if strings.TrimSpace(input) == "s" {
+	input := awaitInput()
+	for !concluded && input != "t" {
+
+		if input == "s" {
 
 			// Request current status of experiment.
 			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/public/experiments/%s/status", *operatorAddrFlag, respExp.ID), nil)
@@ -351,7 +573,7 @@ func main() {
 				fmt.Printf("Failed creating HTTPS API request for status of experiment: %v\n", err)
 				os.Exit(1)
 			}
-			req.Header.Set(http.CanonicalHeaderKey("Authorization"), "UniverseOfLoopholes")
+			req.Header.Set(http.CanonicalHeaderKey("Authorization"), fmt.Sprintf("Bearer %s", apiToken))
 			req.Header.Set(http.CanonicalHeaderKey("Content-Type"), "application/json")
 
 			// Send status request.
@@ -375,37 +597,42 @@ func main() {
 		}
 
 		fmt.Printf("Type 's' for 'status' or 't' for 'terminate' and press ENTER...")
-		input, _ = stdIn.ReadString('\n')
+		input = awaitInput()
 	}
 
-	fmt.Printf("\nWill instruct operator to terminate experiment...")
+	if concluded {
+		fmt.Printf("\nOperator concluded experiment %s without confirmation.\n", respExp.ID)
+	} else {
 
-	// Read OAuth token from gcloud.
-	outRaw, err = exec.Command("/opt/google-cloud-sdk/bin/gcloud", "auth", "print-access-token").CombinedOutput()
-	if err != nil {
-		fmt.Printf("Could not obtain OAuth2 access token (error: '%v'):\n%s\n", err, outRaw)
-		os.Exit(1)
-	}
-	accessToken = strings.TrimSpace(string(outRaw))
+		fmt.Printf("\nWill instruct operator to terminate experiment...")
 
-	// Request termination of experiment.
-	req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/public/experiments/%s/terminate", *operatorAddrFlag, respExp.ID), nil)
-	if err != nil {
-		fmt.Printf("Failed creating HTTPS API request to terminate experiment: %v\n", err)
-		os.Exit(1)
-	}
-	req.Header.Set(http.CanonicalHeaderKey("Authorization"), "UniverseOfLoopholes")
-	req.Header.Set(http.CanonicalHeaderKey("AccessToken"), accessToken)
-	req.Header.Set(http.CanonicalHeaderKey("Content-Type"), "application/json")
+		// Read OAuth token from gcloud.
+		outRaw, err = exec.Command("/opt/google-cloud-sdk/bin/gcloud", "auth", "print-access-token").CombinedOutput()
+		if err != nil {
+			fmt.Printf("Could not obtain OAuth2 access token (error: '%v'):\n%s\n", err, outRaw)
+			os.Exit(1)
+		}
+		accessToken = strings.TrimSpace(string(outRaw))
 
-	// Send termination request.
-	_, err = client.Do(req)
-	if err != nil {
-		fmt.Printf("Failed sending HTTPS API request to terminate experiment: %v\n", err)
-		os.Exit(1)
-	}
+		// Request termination of experiment.
+		req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/public/experiments/%s/terminate", *operatorAddrFlag, respExp.ID), nil)
+		if err != nil {
+			fmt.Printf("Failed creating HTTPS API request to terminate experiment: %v\n", err)
+			os.Exit(1)
+		}
+		req.Header.Set(http.CanonicalHeaderKey("Authorization"), fmt.Sprintf("Bearer %s", apiToken))
+		req.Header.Set(http.CanonicalHeaderKey("AccessToken"), accessToken)
+		req.Header.Set(http.CanonicalHeaderKey("Content-Type"), "application/json")
+
+		// Send termination request.
+		_, err = client.Do(req)
+		if err != nil {
+			fmt.Printf("Failed sending HTTPS API request to terminate experiment: %v\n", err)
+			os.Exit(1)
+		}
 
-	fmt.Printf(" done!\n")
+		fmt.Printf(" done!\n")
+	}
 
 	if !*applyHighDelayFlag && !*applyHighLossFlag {
 
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TailProgress follows the progress stream of an
+// experiment at the operator and prints each line
+// as soon as it arrives. Dropped connections are
+// resumed after the last line received. Returns
+// true once the operator signals the end of the
+// stream and false if it refuses the stream.
+func TailProgress(client *http.Client, operatorAddr string, apiToken string, expID string) bool {
+
+	lastEventID := ""
+
+	for {
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/public/experiments/%s/progress/stream", operatorAddr, expID), nil)
+		if err != nil {
+			fmt.Printf("Failed creating HTTPS API request for progress stream of experiment: %v\n", err)
+			return false
+		}
+		req.Header.Set(http.CanonicalHeaderKey("Authorization"), fmt.Sprintf("Bearer %s", apiToken))
+		req.Header.Set(http.CanonicalHeaderKey("Accept"), "text/event-stream")
+		if lastEventID != "" {
+			req.Header.Set(http.CanonicalHeaderKey("Last-Event-ID"), lastEventID)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			fmt.Printf("Progress stream of experiment interrupted, reconnecting: %v\n", err)
+			time.Sleep(2 * time.Second)
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("Operator refused progress stream of experiment with status %d.\n", resp.StatusCode)
+			resp.Body.Close()
+			return false
+		}
+
+		event := ""
+		data := make([]string, 0, 1)
+		ended := false
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+
+			line := scanner.Text()
+
+			if strings.HasPrefix(line, "id: ") {
+				lastEventID = strings.TrimPrefix(line, "id: ")
+			} else if strings.HasPrefix(line, "event: ") {
+				event = strings.TrimPrefix(line, "event: ")
+			} else if strings.HasPrefix(line, "data: ") {
+				data = append(data, strings.TrimPrefix(line, "data: "))
+			} else if line == "" {
+
+				// Empty line dispatches the event.
+				if event == "progress" {
+					fmt.Printf("%s\n", strings.Join(data, "\n"))
+				} else if event == "end" {
+					ended = true
+					break
+				}
+
+				event = ""
+				data = data[:0]
+			}
+		}
+		resp.Body.Close()
+
+		if ended {
+			return true
+		}
+
+		fmt.Printf("Progress stream of experiment interrupted, reconnecting...\n")
+		time.Sleep(2 * time.Second)
+	}
+}
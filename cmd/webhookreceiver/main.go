@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Event mirrors the payload the operator
+// posts to its webhooks.
+type Event struct {
+	Seq          uint64    `json:"seq"`
+	Type         string    `json:"type"`
+	At           time.Time `json:"at"`
+	ExpID        string    `json:"expID"`
+	System       string    `json:"system"`
+	ResultFolder string    `json:"resultFolder"`
+	State        string    `json:"state"`
+	Worker       string    `json:"worker,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+}
+
+// Receiver is a local stand-in for a webhook
+// consumer that verifies the signature of each
+// event and prints it.
+type Receiver struct {
+	Secret []byte
+}
+
+// validSignature checks the signature header
+// against the HMAC-SHA256 of body.
+func (recv *Receiver) validSignature(header string, body []byte) bool {
+
+	if !strings.HasPrefix(header, "sha256=") {
+		return false
+	}
+
+	sig, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, recv.Secret)
+	mac.Write(body)
+
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// ServeHTTP accepts one posted event.
+func (recv *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !recv.validSignature(req.Header.Get("X-ACS-Signature"), body) {
+		fmt.Printf("[RECEIVER] Rejecting event from %s with invalid signature.\n", req.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	event := &Event{}
+	err = json.Unmarshal(body, event)
+	if err != nil {
+		fmt.Printf("[RECEIVER] Rejecting malformed event from %s: %v\n", req.RemoteAddr, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	details := ""
+	if event.Worker != "" {
+		details = fmt.Sprintf(" worker=%s", event.Worker)
+	}
+	if event.Reason != "" {
+		details = fmt.Sprintf("%s reason='%s'", details, event.Reason)
+	}
+
+	fmt.Printf("[%s] #%d %s exp=%s system=%s state=%s%s\n", event.At.Format("2006-01-02 15:04:05"),
+		event.Seq, event.Type, event.ExpID, event.System, event.State, details)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func main() {
+
+	// Command-line options.
+	listenAddrFlag := flag.String("listenAddr", "127.0.0.1:20090", "Specify the address to receive webhook events from the operator on via plain HTTP.")
+	secretFlag := flag.String("secret", "", "Specify the secret shared with the operator to verify event signatures with, falls back to environment variable ACS_WEBHOOK_SECRET.")
+	flag.Parse()
+
+	secret := *secretFlag
+	if secret == "" {
+		secret = os.Getenv("ACS_WEBHOOK_SECRET")
+	}
+
+	if secret == "" {
+		fmt.Printf("Missing argument, please provide the webhook secret via '-secret' or environment variable ACS_WEBHOOK_SECRET.\n")
+		os.Exit(1)
+	}
+
+	fmt.Printf("[RECEIVER] Listening on http://%s for webhook events...\n", *listenAddrFlag)
+
+	err := http.ListenAndServe(*listenAddrFlag, &Receiver{Secret: []byte(secret)})
+	if err != nil {
+		fmt.Printf("[RECEIVER] Failed serving webhook events: %v\n", err)
+		os.Exit(1)
+	}
+}
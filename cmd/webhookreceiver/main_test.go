@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sign returns the signature header value
+// for body keyed with secret.
+func sign(secret string, body string) string {
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestReceiverVerifiesSignature(t *testing.T) {
+
+	body := `{"seq":1,"type":"queued","expID":"exp1"}`
+
+	tests := []struct {
+		name      string
+		signature string
+		status    int
+	}{
+		{"matching secret", sign("shared-secret", body), http.StatusNoContent},
+		{"wrong secret", sign("other-secret", body), http.StatusUnauthorized},
+		{"other body", sign("shared-secret", `{"seq":2}`), http.StatusUnauthorized},
+		{"missing prefix", strings.TrimPrefix(sign("shared-secret", body), "sha256="), http.StatusUnauthorized},
+		{"missing header", "", http.StatusUnauthorized},
+	}
+
+	recv := &Receiver{Secret: []byte("shared-secret")}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			if test.signature != "" {
+				req.Header.Set("X-ACS-Signature", test.signature)
+			}
+
+			w := httptest.NewRecorder()
+			recv.ServeHTTP(w, req)
+
+			if w.Code != test.status {
+				t.Errorf("expected status %d, got %d", test.status, w.Code)
+			}
+		})
+	}
+}